@@ -4,116 +4,545 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Oppodelldog/filediscovery"
+	"github.com/fsnotify/fsnotify"
+	"github.com/miekg/dns"
 
 	"github.com/sirupsen/logrus"
 )
 
 const aliasLoaderDefaultInterval = 10 * time.Second
+const aliasReloadDelay = 100 * time.Millisecond
 const aliasFilePathEnvKey = "DOCKER_DNS_ALIAS_FILE"
+const aliasDirPathEnvKey = "DOCKER_DNS_ALIAS_DIR"
+const aliasDirName = "alias.d"
+const defaultAliasDepth = 8
+
+var ErrFileWatcherClosed = errors.New("file watcher closed")
+var ErrMalformedAliasLine = errors.New("expected '<domain> <target>'")
+var ErrDuplicateAlias = errors.New("duplicate alias")
+var ErrAliasConflict = errors.New("conflicting alias")
+var ErrNoAliasFiles = errors.New("neither alias file nor alias directory found")
+
+// AliasLineError reports an invalid line of an alias file.
+type AliasLineError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e AliasLineError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+	}
+
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+func (e AliasLineError) Unwrap() error {
+	return e.Err
+}
 
 // AliasFileLoader loads the alias file which holds value pairs defining alias for a container name.
 // see data/alias for an example.
+// The files of the alias.d directory next to the alias file are merged into the aliases in lexical order,
+// so that aliases may be split into drop-in files.
+// Readers get the aliases from an immutable AliasSnapshot without locking.
 type AliasFileLoader struct {
-	aliases         map[string]string
+	snapshot        atomic.Pointer[AliasSnapshot]
 	aliasFileFinder filediscovery.FileDiscoverer
-	lock            sync.Mutex
+	// lock serializes loading, so that versions of snapshots increase in the order they are published.
+	lock     sync.Mutex
+	maxDepth int
 }
 
 // NewAliasFileLoader creates a new *AliasFileLoader.
-func NewAliasFileLoader(ctx context.Context) *AliasFileLoader {
+// Aliases of aliases are followed up to maxDepth aliases, if maxDepth is not positive up to defaultAliasDepth.
+func NewAliasFileLoader(ctx context.Context, maxDepth int) *AliasFileLoader {
+	if maxDepth <= 0 {
+		maxDepth = defaultAliasDepth
+	}
+
 	a := &AliasFileLoader{
-		aliases: map[string]string{},
-		aliasFileFinder: filediscovery.New(
-			[]filediscovery.FileLocationProvider{
-				filediscovery.EnvVarFilePathProvider(aliasFilePathEnvKey),
-				filediscovery.ExecutableDirProvider("data"),
-			},
-		),
-		lock: sync.Mutex{},
+		aliasFileFinder: newAliasFileFinder(),
+		lock:            sync.Mutex{},
+		maxDepth:        maxDepth,
 	}
 
+	a.snapshot.Store(&AliasSnapshot{aliases: newAliasSet(), maxDepth: maxDepth})
+
 	a.startAliasLoader(ctx)
 
 	return a
 }
 
+func newAliasFileFinder() filediscovery.FileDiscoverer {
+	return filediscovery.New(
+		[]filediscovery.FileLocationProvider{
+			filediscovery.EnvVarFilePathProvider(aliasFilePathEnvKey),
+			filediscovery.ExecutableDirProvider("data"),
+		},
+	)
+}
+
+// DiscoverAliasFiles returns the paths of the alias files an AliasFileLoader would load, in the order they are merged.
+func DiscoverAliasFiles() ([]string, error) {
+	return discoverAliasSources(newAliasFileFinder()).files()
+}
+
+// aliasSources are the alias file and the alias directory holding drop-in files, either is empty if not found.
+type aliasSources struct {
+	file string
+	dir  string
+}
+
+// discoverAliasSources finds the alias file and the alias directory, which is located next to the alias file,
+// or if there is none, in the data directory, unless DOCKER_DNS_ALIAS_DIR is set.
+func discoverAliasSources(finder filediscovery.FileDiscoverer) aliasSources {
+	var sources aliasSources
+
+	if path, err := finder.Discover("alias"); err == nil {
+		sources.file = path
+	} else {
+		logrus.Debugf("No alias file found: %v", err)
+	}
+
+	switch dir, isSet := os.LookupEnv(aliasDirPathEnvKey); {
+	case isSet:
+		sources.dir = dir
+	case sources.file != "":
+		sources.dir = filepath.Join(filepath.Dir(sources.file), aliasDirName)
+	default:
+		if dir, err := filediscovery.ExecutableDirProvider("data")(aliasDirName); err == nil {
+			sources.dir = dir
+		}
+	}
+
+	return sources
+}
+
+// files returns the alias file followed by the files of the alias directory in lexical order.
+func (s aliasSources) files() ([]string, error) {
+	var paths []string
+
+	if s.file != "" {
+		paths = append(paths, s.file)
+	}
+
+	dropIns, err := aliasDirFiles(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	paths = append(paths, dropIns...)
+
+	if len(paths) == 0 {
+		return nil, ErrNoAliasFiles
+	}
+
+	return paths, nil
+}
+
+// aliasDirFiles returns the regular files of the alias directory in lexical order, skipping hidden files.
+// A missing directory has no files.
+func aliasDirFiles(dir string) ([]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("cannot read alias directory: %w", err)
+	}
+
+	var paths []string
+
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		paths = append(paths, path)
+	}
+
+	return paths, nil
+}
+
 func (l *AliasFileLoader) startAliasLoader(ctx context.Context) {
 	logrus.Info("Starting Alias loader")
 
 	go func() {
 		l.loadAliasesFromFile()
 
-		ticker := time.NewTicker(aliasLoaderDefaultInterval)
+		if err := l.watchAliasFile(ctx); err != nil {
+			logrus.Warnf("Cannot watch alias file, polling every %v instead: %v", aliasLoaderDefaultInterval, err)
+
+			l.pollAliasFile(ctx)
+		}
+	}()
+}
+
+func (l *AliasFileLoader) pollAliasFile(ctx context.Context) {
+	ticker := time.NewTicker(aliasLoaderDefaultInterval)
+	defer ticker.Stop()
 
-		for {
-			select {
-			case <-ctx.Done():
-				logrus.Info("Stopping Alias loader")
+	for {
+		select {
+		case <-ctx.Done():
+			logrus.Info("Stopping Alias loader")
 
-				return
-			case <-ticker.C:
-				l.loadAliasesFromFile()
-			}
+			return
+		case <-ticker.C:
+			l.loadAliasesFromFile()
+		}
+	}
+}
+
+// watchAliasFile reloads the aliases whenever the alias file or a file of the alias directory changes
+// until ctx is done. Directories are watched instead of the files themselves, so that files replaced by rename
+// (editors) or by swapping a symlinked directory (Kubernetes ConfigMaps) are noticed as well.
+func (l *AliasFileLoader) watchAliasFile(ctx context.Context) error {
+	sources := discoverAliasSources(l.aliasFileFinder)
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("cannot create file watcher: %w", err)
+	}
+
+	defer func() {
+		if err := watcher.Close(); err != nil {
+			logrus.Errorf("Could not close file watcher: %v", err)
 		}
 	}()
+
+	var watched []string
+
+	for _, dir := range sources.watchDirs() {
+		if err := watcher.Add(dir); err != nil {
+			logrus.Debugf("Cannot watch '%s': %v", dir, err)
+
+			continue
+		}
+
+		watched = append(watched, dir)
+	}
+
+	if len(watched) == 0 {
+		return fmt.Errorf("cannot watch any of %s: %w", strings.Join(sources.watchDirs(), ", "), ErrNoAliasFiles)
+	}
+
+	logrus.Infof("Watching %s for alias changes", strings.Join(watched, ", "))
+
+	var (
+		resolvedPaths = sources.resolveSymlinks()
+		reload        <-chan time.Time
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			logrus.Info("Stopping Alias loader")
+
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return ErrFileWatcherClosed
+			}
+
+			if sources.isAffectedBy(event.Name) || sources.resolveSymlinks() != resolvedPaths {
+				// editors and ConfigMap updates cause bursts of events, reload once they settled
+				reload = time.After(aliasReloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return ErrFileWatcherClosed
+			}
+
+			logrus.Errorf("Error watching alias file: %v", err)
+		case <-reload:
+			reload = nil
+			resolvedPaths = sources.resolveSymlinks()
+
+			if sources.dir != "" {
+				// the alias directory may have been created after watching started
+				_ = watcher.Add(sources.dir)
+			}
+
+			l.loadAliasesFromFile()
+		}
+	}
+}
+
+// watchDirs returns the directories to watch for changes of the alias sources: the directory of the alias file,
+// the alias directory and its parent, which notices the alias directory being created.
+func (s aliasSources) watchDirs() []string {
+	var dirs []string
+
+	for _, dir := range []string{s.file, s.dir} {
+		if dir == "" {
+			continue
+		}
+
+		for _, d := range []string{filepath.Dir(dir), dir} {
+			if d != s.file && !containsString(dirs, d) {
+				dirs = append(dirs, d)
+			}
+		}
+	}
+
+	return dirs
+}
+
+func (s aliasSources) isAffectedBy(name string) bool {
+	name = filepath.Clean(name)
+
+	switch {
+	case s.file != "" && name == filepath.Clean(s.file):
+		return true
+	case s.dir != "" && (name == filepath.Clean(s.dir) || filepath.Dir(name) == filepath.Clean(s.dir)):
+		return true
+	default:
+		return false
+	}
+}
+
+func (s aliasSources) resolveSymlinks() string {
+	return resolveSymlinks(s.file) + string(filepath.ListSeparator) + resolveSymlinks(s.dir)
+}
+
+func resolveSymlinks(path string) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return ""
+	}
+
+	return resolved
+}
+
+// AliasLoadResult is the outcome of loading the alias files.
+type AliasLoadResult struct {
+	// Aliases is the number of aliases in use after loading.
+	Aliases int
+	// Applied is false if the alias files could not be loaded and the previous aliases are kept.
+	Applied bool
+	// Version is the version of the snapshot in use after loading.
+	Version  uint64
+	Errors   []error
+	Warnings []error
+}
+
+// Reload loads the alias files immediately, independent of file change notifications.
+func (l *AliasFileLoader) Reload() AliasLoadResult {
+	return l.loadAliasesFromFile()
 }
 
-func (l *AliasFileLoader) loadAliasesFromFile() {
+func (l *AliasFileLoader) loadAliasesFromFile() AliasLoadResult {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
 	logrus.Debug("Loading Alias file")
 
-	aliasFilePath, err := l.aliasFileFinder.Discover("alias")
+	current := l.Snapshot()
+
+	aliasFilePaths, err := discoverAliasSources(l.aliasFileFinder).files()
 	if err != nil {
 		logrus.Errorf("Could not find alias file: %v\n", err)
 
-		return
+		return AliasLoadResult{Aliases: current.Len(), Version: current.Version, Errors: []error{err}}
 	}
 
-	logrus.Infof("Loading Alias file from '%s'", aliasFilePath)
+	logrus.Debugf("Loading Alias files %s", strings.Join(aliasFilePaths, ", "))
 
-	content, err := os.ReadFile(aliasFilePath)
-	if err != nil {
-		logrus.Errorf("Could not load aliases: %v\n", err)
+	newAliases, report := parseAliasFiles(aliasFilePaths)
 
-		return
+	for _, warning := range report.Warnings {
+		logrus.Warnf("Alias file: %v", warning)
+	}
+
+	if report.HasErrors() {
+		for _, err := range report.Errors {
+			logrus.Errorf("Invalid alias file: %v", err)
+		}
+
+		logrus.Errorf("Keeping the previous %v aliases", current.Len())
+
+		return AliasLoadResult{
+			Aliases:  current.Len(),
+			Version:  current.Version,
+			Errors:   report.Errors,
+			Warnings: report.Warnings,
+		}
+	}
+
+	logrus.Infof("number of aliases: %v", newAliases.len())
+
+	for _, definition := range newAliases.definitions() {
+		logrus.Debugf("alias %s -> %s from %s", definition.Domain, definition.Target, definition.Source)
+	}
+
+	snapshot := newAliasSnapshot(newAliases, l.maxDepth, current.Version+1)
+	l.snapshot.Store(snapshot)
+
+	return AliasLoadResult{Aliases: snapshot.Len(), Applied: true, Version: snapshot.Version, Warnings: report.Warnings}
+}
+
+// Snapshot returns the aliases currently in use.
+func (l *AliasFileLoader) Snapshot() *AliasSnapshot {
+	return l.snapshot.Load()
+}
+
+// parseAliasFiles parses the given alias files and merges them in order, later definitions override earlier ones.
+// Each file is either a plain alias file (see data/alias) or a structured alias document (see data/alias.yaml).
+// Every invalid alias is reported as AliasLineError, repeated domains as warnings and domains repeated in another
+// file as conflicts.
+func parseAliasFiles(paths []string) (aliasSet, AliasFileReport) {
+	parser := newAliasParser()
+
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			parser.report.Errors = append(parser.report.Errors, fmt.Errorf("cannot read alias file: %w", err))
+
+			continue
+		}
+
+		parser.parse(path, content)
+	}
+
+	parser.report.Errors = append(parser.report.Errors, parser.aliases.loopErrors()...)
+
+	return parser.aliases, parser.report
+}
+
+type (
+	// aliasParser collects the aliases of alias files and the problems found.
+	aliasParser struct {
+		aliases   aliasSet
+		report    AliasFileReport
+		file      string
+		positions map[string]aliasPosition
 	}
+	aliasPosition struct {
+		file string
+		line int
+	}
+)
+
+func newAliasParser() *aliasParser {
+	return &aliasParser{
+		aliases:   newAliasSet(),
+		positions: map[string]aliasPosition{},
+	}
+}
+
+func (p aliasPosition) String() string {
+	return fmt.Sprintf("%s:%d", p.file, p.line)
+}
+
+func (p *aliasParser) parse(file string, content []byte) {
+	p.file = file
+
+	switch detectAliasFormat(file, content) {
+	case aliasFormatYAML:
+		p.parseYAML(content)
+	case aliasFormatTOML:
+		p.parseTOML(content)
+	default:
+		p.parsePlain(content)
+	}
+}
 
-	newAliases := map[string]string{}
+func (p *aliasParser) parsePlain(content []byte) {
+	var lineNo int
 
 	scanner := bufio.NewScanner(bytes.NewBuffer(content))
 	for scanner.Scan() {
-		line := scanner.Text()
-		fields := strings.Fields(line)
+		lineNo++
+		fields := withoutComment(strings.Fields(scanner.Text()))
 
 		const requiredValues = 2
-		if len(fields) == requiredValues {
-			if strings.Contains(fields[0], "#") {
-				continue
-			}
 
-			newAliases[fields[0]] = fields[1]
+		switch len(fields) {
+		case 0:
+			continue
+		case requiredValues:
+			p.add(lineNo, fields[0], Alias{Target: fields[1]})
+		default:
+			p.addError(lineNo, ErrMalformedAliasLine)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		p.report.Errors = append(p.report.Errors, fmt.Errorf("cannot read aliases: %w", err))
+	}
+}
+
+func (p *aliasParser) add(lineNo int, domain string, alias Alias) {
+	position := aliasPosition{file: p.file, line: lineNo}
+	alias.Source = position.String()
+
+	if err := p.aliases.add(domain, alias); err != nil {
+		p.addError(lineNo, err)
+
+		return
+	}
+
+	key := domain
+	if !isAliasPattern(domain) {
+		key = dns.CanonicalName(domain)
+	}
+
+	if previous, ok := p.positions[key]; ok {
+		err := fmt.Errorf("%w '%s', overrides line %d", ErrDuplicateAlias, domain, previous.line)
+		if previous.file != p.file {
+			err = fmt.Errorf("%w '%s', overrides %s", ErrAliasConflict, domain, previous)
 		}
+
+		p.report.Warnings = append(p.report.Warnings, AliasLineError{File: p.file, Line: lineNo, Err: err})
 	}
 
-	numberOfAliases := len(newAliases)
-	logrus.Errorf("number of aliases: %v\n", numberOfAliases)
+	p.positions[key] = position
+}
 
-	if numberOfAliases > 0 {
-		l.lock.Lock()
-		l.aliases = newAliases
-		l.lock.Unlock()
+func (p *aliasParser) addError(lineNo int, err error) {
+	p.report.Errors = append(p.report.Errors, AliasLineError{File: p.file, Line: lineNo, Err: err})
+}
+
+// withoutComment drops all fields starting at the first one beginning with #.
+func withoutComment(fields []string) []string {
+	for i, field := range fields {
+		if strings.HasPrefix(field, "#") {
+			return fields[:i]
+		}
 	}
+
+	return fields
 }
 
+// GetAliasForDomain returns the final target of the alias chain starting at domain.
 func (l *AliasFileLoader) GetAliasForDomain(domain string) (string, bool) {
-	if alias, ok := l.aliases[domain]; ok {
-		return alias, true
-	}
+	return l.Snapshot().GetAliasForDomain(domain)
+}
 
-	return "", false
+// GetAlias returns the alias defined for the domain, see AliasSnapshot.GetAlias.
+func (l *AliasFileLoader) GetAlias(domain string) (Alias, bool) {
+	return l.Snapshot().GetAlias(domain)
 }
@@ -0,0 +1,275 @@
+package dnsserver
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeAliasFile(t *testing.T, name string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("cannot write alias file: %v", err)
+	}
+
+	return path
+}
+
+func TestParseAliasFilesPlain(t *testing.T) {
+	t.Parallel()
+
+	path := writeAliasFile(t, "alias", `# comment
+www.pong.com.   pong.   # trailing comment
+
+*.pong.test.    pong.
+/(.+)\.tenant\./ $1.
+static.test.    10.0.0.1,fd00::1
+`)
+
+	aliases, report := parseAliasFiles([]string{path})
+	if report.HasErrors() || len(report.Warnings) > 0 {
+		t.Fatalf("unexpected problems: %v %v", report.Errors, report.Warnings)
+	}
+
+	if got := aliases.len(); got != 4 {
+		t.Fatalf("expected 4 aliases, got %d", got)
+	}
+
+	alias, ok := aliases.lookup("www.pong.com.")
+	if !ok || alias.Target != "pong." {
+		t.Errorf("expected www.pong.com. -> pong., got %v %v", alias.Target, ok)
+	}
+
+	if want := path + ":2"; alias.Source != want {
+		t.Errorf("expected source %s, got %s", want, alias.Source)
+	}
+}
+
+func TestParseAliasFilesPlainLookingLikeYAML(t *testing.T) {
+	t.Parallel()
+
+	for _, content := range []string{
+		"v6.test. 2001:db8::\n",
+		"v6.test. ::\n",
+		"# comment\nv6.test. fd00::\nv4.test. 10.0.0.1\n",
+	} {
+		content := content
+
+		t.Run(content, func(t *testing.T) {
+			t.Parallel()
+
+			aliases, report := parseAliasFiles([]string{writeAliasFile(t, "alias", content)})
+			if report.HasErrors() {
+				t.Fatalf("unexpected errors: %v", report.Errors)
+			}
+
+			if _, ok := aliases.lookup("v6.test."); !ok {
+				t.Error("expected alias v6.test.")
+			}
+		})
+	}
+}
+
+func TestParseAliasFilesEmpty(t *testing.T) {
+	t.Parallel()
+
+	for name, content := range map[string]string{
+		"empty":         "",
+		"comments only": "# nothing here\n\n   # indented comment\n",
+	} {
+		name, content := name, content
+
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			aliases, report := parseAliasFiles([]string{writeAliasFile(t, "alias", content)})
+			if report.HasErrors() || len(report.Warnings) > 0 {
+				t.Fatalf("unexpected problems: %v %v", report.Errors, report.Warnings)
+			}
+
+			if aliases.len() != 0 {
+				t.Errorf("expected no aliases, got %d", aliases.len())
+			}
+		})
+	}
+}
+
+func TestParseAliasFilesLineErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		content string
+		line    int
+		err     error
+	}{
+		{name: "missing target", content: "www.pong.com.\n", line: 1, err: ErrMalformedAliasLine},
+		{name: "too many fields", content: "ok.test. pong.\nwww.pong.com. pong. other.\n", line: 2, err: ErrMalformedAliasLine},
+		{name: "not fully qualified", content: "www.pong.com pong.\n", line: 1, err: ErrNotFullyQualified},
+		{name: "target not fully qualified", content: "\nwww.pong.com. pong\n", line: 2, err: ErrNotFullyQualified},
+		{name: "invalid pattern", content: "/(/ pong.\n", line: 1, err: ErrInvalidAliasPattern},
+		{name: "mixed target list", content: "a.test. 10.0.0.1,pong.\n", line: 1, err: ErrInvalidAliasTarget},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, report := parseAliasFiles([]string{writeAliasFile(t, "alias", testCase.content)})
+			if len(report.Errors) != 1 {
+				t.Fatalf("expected one error, got %v", report.Errors)
+			}
+
+			var lineErr AliasLineError
+			if !errors.As(report.Errors[0], &lineErr) {
+				t.Fatalf("expected AliasLineError, got %T: %v", report.Errors[0], report.Errors[0])
+			}
+
+			if lineErr.Line != testCase.line {
+				t.Errorf("expected line %d, got %d", testCase.line, lineErr.Line)
+			}
+
+			if !errors.Is(lineErr, testCase.err) {
+				t.Errorf("expected %v, got %v", testCase.err, lineErr)
+			}
+		})
+	}
+}
+
+func TestParseAliasFilesDuplicates(t *testing.T) {
+	t.Parallel()
+
+	aliases, report := parseAliasFiles([]string{writeAliasFile(t, "alias", "www.pong.com. pong.\nWWW.pong.com. ping.\n")})
+	if report.HasErrors() {
+		t.Fatalf("unexpected errors: %v", report.Errors)
+	}
+
+	if len(report.Warnings) != 1 || !errors.Is(report.Warnings[0], ErrDuplicateAlias) {
+		t.Fatalf("expected a duplicate alias, got %v", report.Warnings)
+	}
+
+	if alias, _ := aliases.lookup("www.pong.com."); alias.Target != "ping." {
+		t.Errorf("expected the later line to win, got %s", alias.Target)
+	}
+}
+
+func TestParseAliasFilesStructured(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name:    "yaml",
+			file:    "alias",
+			content: "aliases:\n  - name: www.pong.com.\n    target: pong.\n    type: cname\n    ttl: 10\n",
+		},
+		{
+			name:    "yaml with extension",
+			file:    "alias.yml",
+			content: "- name: www.pong.com.\n  target: pong.\n  type: cname\n  ttl: 10\n",
+		},
+		{
+			name:    "json",
+			file:    "alias",
+			content: `{"aliases": [{"name": "www.pong.com.", "target": "pong.", "type": "cname", "ttl": 10}]}`,
+		},
+		{
+			name:    "json list",
+			file:    "alias",
+			content: `[{"name": "www.pong.com.", "target": "pong.", "type": "cname", "ttl": 10}]`,
+		},
+		{
+			name:    "toml",
+			file:    "alias",
+			content: "[[aliases]]\nname = \"www.pong.com.\"\ntarget = \"pong.\"\ntype = \"cname\"\nttl = 10\n",
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			aliases, report := parseAliasFiles([]string{writeAliasFile(t, testCase.file, testCase.content)})
+			if report.HasErrors() {
+				t.Fatalf("unexpected errors: %v", report.Errors)
+			}
+
+			alias, ok := aliases.lookup("www.pong.com.")
+			if !ok {
+				t.Fatal("expected alias www.pong.com.")
+			}
+
+			if alias.Target != "pong." || alias.Type != AliasTypeCNAME || alias.TTL != 10 {
+				t.Errorf("unexpected alias %+v", alias)
+			}
+		})
+	}
+}
+
+func TestParseAliasFilesStructuredErrors(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		file    string
+		content string
+		err     error
+	}{
+		{name: "unknown field", file: "alias.yaml", content: "- name: a.test.\n  target: pong.\n  port: 80\n", err: ErrUnknownAliasField},
+		{name: "unknown key", file: "alias", content: "version: 1\naliases: []\n", err: ErrUnknownAliasField},
+		{name: "missing target", file: "alias.json", content: `[{"name": "a.test."}]`, err: ErrMissingAliasField},
+		{name: "malformed json", file: "alias", content: `{"aliases": [`, err: ErrMalformedAliasDocument},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, report := parseAliasFiles([]string{writeAliasFile(t, testCase.file, testCase.content)})
+			if len(report.Errors) != 1 || !errors.Is(report.Errors[0], testCase.err) {
+				t.Errorf("expected %v, got %v", testCase.err, report.Errors)
+			}
+		})
+	}
+}
+
+func TestParseAliasFilesConflict(t *testing.T) {
+	t.Parallel()
+
+	aliasFile := writeAliasFile(t, "alias", "www.pong.com. pong.\n")
+	dropIn := writeAliasFile(t, "10-web", "www.pong.com. web.\n")
+
+	aliases, report := parseAliasFiles([]string{aliasFile, dropIn})
+	if report.HasErrors() {
+		t.Fatalf("unexpected errors: %v", report.Errors)
+	}
+
+	if len(report.Warnings) != 1 || !errors.Is(report.Warnings[0], ErrAliasConflict) {
+		t.Fatalf("expected a conflicting alias, got %v", report.Warnings)
+	}
+
+	if alias, _ := aliases.lookup("www.pong.com."); alias.Target != "web." {
+		t.Errorf("expected the drop-in file to win, got %s", alias.Target)
+	}
+}
+
+func TestParseAliasFilesLoop(t *testing.T) {
+	t.Parallel()
+
+	_, report := parseAliasFiles([]string{writeAliasFile(t, "alias", "a.test. b.test.\nb.test. a.test.\n")})
+	if len(report.Errors) != 1 || !errors.Is(report.Errors[0], ErrAliasLoop) {
+		t.Fatalf("expected an alias loop, got %v", report.Errors)
+	}
+}
@@ -0,0 +1,267 @@
+package dnsserver
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+var ErrMalformedAliasDocument = errors.New("malformed alias document")
+var ErrUnknownAliasField = errors.New("unknown field")
+var ErrMissingAliasField = errors.New("missing field")
+
+const (
+	aliasFormatPlain = iota
+	aliasFormatYAML
+	aliasFormatTOML
+)
+
+const tomlAliasTable = "[[aliases]]"
+
+// aliasDocumentEntry is an alias of a structured alias document, see data/alias.yaml.
+type aliasDocumentEntry struct {
+	Name    string   `yaml:"name" toml:"name"`
+	Target  string   `yaml:"target" toml:"target"`
+	Type    string   `yaml:"type" toml:"type"`
+	TTL     uint32   `yaml:"ttl" toml:"ttl"`
+	Tags    []string `yaml:"tags" toml:"tags"`
+	Comment string   `yaml:"comment" toml:"comment"`
+}
+
+var aliasDocumentFields = map[string]bool{
+	"name": true, "target": true, "type": true, "ttl": true, "tags": true, "comment": true,
+}
+
+// detectAliasFormat tells the format of an alias file by its extension: .yaml, .yml and .json are YAML, .toml is TOML.
+// Files with another extension are structured only if they clearly are an alias document: a TOML document with
+// [[aliases]] tables, a YAML document with an aliases key or a list of aliases. Malformed documents are recognized by
+// their first line which is neither empty nor a comment. Anything else is a plain alias file, even if it happens to
+// decode as YAML like "v6.test. 2001:db8::".
+// JSON documents are parsed as YAML, which they are a subset of.
+func detectAliasFormat(file string, content []byte) int {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml", ".json":
+		return aliasFormatYAML
+	case ".toml":
+		return aliasFormatTOML
+	}
+
+	switch {
+	case isTOMLDocument(content):
+		return aliasFormatTOML
+	case isYAMLDocument(content):
+		return aliasFormatYAML
+	}
+
+	scanner := bufio.NewScanner(bytes.NewBuffer(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == "", strings.HasPrefix(line, "#"):
+			continue
+		case strings.HasPrefix(line, tomlAliasTable):
+			return aliasFormatTOML
+		case strings.HasPrefix(line, "{"), strings.HasPrefix(line, "["), line == "---", strings.HasPrefix(line, "aliases:"):
+			return aliasFormatYAML
+		default:
+			return aliasFormatPlain
+		}
+	}
+
+	return aliasFormatPlain
+}
+
+// isTOMLDocument reports whether content decodes as a TOML document with an aliases key.
+func isTOMLDocument(content []byte) bool {
+	var document map[string]interface{}
+
+	if _, err := toml.Decode(string(content), &document); err != nil {
+		return false
+	}
+
+	_, ok := document["aliases"]
+
+	return ok
+}
+
+// isYAMLDocument reports whether content decodes as a YAML mapping with an aliases key or a list of mappings
+// holding a name or target, which is what a YAML or JSON alias document looks like.
+func isYAMLDocument(content []byte) bool {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil || len(document.Content) == 0 {
+		return false
+	}
+
+	root := document.Content[0]
+
+	switch root.Kind {
+	case yaml.MappingNode:
+		return hasYAMLKey(root, "aliases")
+	case yaml.SequenceNode:
+		for _, node := range root.Content {
+			if node.Kind != yaml.MappingNode || !(hasYAMLKey(node, "name") || hasYAMLKey(node, "target")) {
+				return false
+			}
+		}
+
+		return len(root.Content) > 0
+	default:
+		return false
+	}
+}
+
+func hasYAMLKey(mapping *yaml.Node, key string) bool {
+	for i := 0; i < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseYAML parses a YAML or JSON document which is either a list of aliases or holds them in the aliases key.
+func (p *aliasParser) parseYAML(content []byte) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(content, &document); err != nil {
+		p.report.Errors = append(p.report.Errors, fmt.Errorf("%w: %w", ErrMalformedAliasDocument, err))
+
+		return
+	}
+
+	if len(document.Content) == 0 {
+		return
+	}
+
+	for _, node := range p.yamlAliasNodes(document.Content[0]) {
+		if err := checkAliasFields(node); err != nil {
+			p.addError(node.Line, err)
+
+			continue
+		}
+
+		var entry aliasDocumentEntry
+		if err := node.Decode(&entry); err != nil {
+			p.addError(node.Line, fmt.Errorf("%w: %w", ErrMalformedAliasDocument, err))
+
+			continue
+		}
+
+		p.addEntry(node.Line, entry)
+	}
+}
+
+func (p *aliasParser) yamlAliasNodes(root *yaml.Node) []*yaml.Node {
+	switch root.Kind {
+	case yaml.SequenceNode:
+		return root.Content
+	case yaml.MappingNode:
+		var aliases []*yaml.Node
+
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			key, value := root.Content[i], root.Content[i+1]
+
+			switch {
+			case key.Value != "aliases":
+				p.addError(key.Line, fmt.Errorf("%w '%s'", ErrUnknownAliasField, key.Value))
+			case value.Kind == yaml.SequenceNode:
+				aliases = value.Content
+			case value.Tag != "!!null":
+				p.addError(value.Line, fmt.Errorf("%w: expected a list of aliases", ErrMalformedAliasDocument))
+			}
+		}
+
+		return aliases
+	default:
+		p.addError(root.Line, fmt.Errorf("%w: expected a list of aliases", ErrMalformedAliasDocument))
+
+		return nil
+	}
+}
+
+// checkAliasFields rejects unknown fields, which yaml.Node.Decode silently ignores.
+func checkAliasFields(node *yaml.Node) error {
+	if node.Kind != yaml.MappingNode {
+		return fmt.Errorf("%w: expected an alias with name and target", ErrMalformedAliasDocument)
+	}
+
+	for i := 0; i < len(node.Content); i += 2 {
+		if key := node.Content[i].Value; !aliasDocumentFields[key] {
+			return fmt.Errorf("%w '%s'", ErrUnknownAliasField, key)
+		}
+	}
+
+	return nil
+}
+
+// parseTOML parses a TOML document holding an [[aliases]] table per alias.
+// Entries are reported by the line of their table header since the TOML decoder does not track positions.
+func (p *aliasParser) parseTOML(content []byte) {
+	var document struct {
+		Aliases []aliasDocumentEntry `toml:"aliases"`
+	}
+
+	metaData, err := toml.Decode(string(content), &document)
+	if err != nil {
+		p.report.Errors = append(p.report.Errors, fmt.Errorf("%w: %w", ErrMalformedAliasDocument, err))
+
+		return
+	}
+
+	for _, key := range metaData.Undecoded() {
+		p.report.Errors = append(p.report.Errors, fmt.Errorf("%w '%s'", ErrUnknownAliasField, key))
+	}
+
+	lines := tomlAliasTableLines(content)
+
+	for i, entry := range document.Aliases {
+		var lineNo int
+		if i < len(lines) {
+			lineNo = lines[i]
+		}
+
+		p.addEntry(lineNo, entry)
+	}
+}
+
+func tomlAliasTableLines(content []byte) []int {
+	var (
+		lines  []int
+		lineNo int
+	)
+
+	scanner := bufio.NewScanner(bytes.NewBuffer(content))
+	for scanner.Scan() {
+		lineNo++
+
+		if strings.HasPrefix(strings.TrimSpace(scanner.Text()), tomlAliasTable) {
+			lines = append(lines, lineNo)
+		}
+	}
+
+	return lines
+}
+
+func (p *aliasParser) addEntry(lineNo int, entry aliasDocumentEntry) {
+	switch {
+	case entry.Name == "":
+		p.addError(lineNo, fmt.Errorf("%w 'name'", ErrMissingAliasField))
+	case entry.Target == "":
+		p.addError(lineNo, fmt.Errorf("%w 'target' of '%s'", ErrMissingAliasField, entry.Name))
+	default:
+		p.add(lineNo, entry.Name, Alias{
+			Target:  entry.Target,
+			Type:    strings.ToLower(entry.Type),
+			TTL:     entry.TTL,
+			Tags:    entry.Tags,
+			Comment: entry.Comment,
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package dnsserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+var ErrInvalidAliasPattern = errors.New("invalid alias pattern")
+var ErrInvalidAliasTarget = errors.New("invalid alias target")
+var ErrInvalidAliasName = errors.New("invalid name")
+var ErrNotFullyQualified = errors.New("name is not fully qualified")
+var ErrInvalidAliasType = errors.New("invalid alias type")
+var ErrAliasDepthExceeded = errors.New("alias chain too long")
+var ErrNoAlias = errors.New("no alias defined")
+
+const wildcardPrefix = "*."
+
+const (
+	// AliasTypeCNAME answers an alias with a CNAME record regardless of the alias-cname option.
+	AliasTypeCNAME = "cname"
+	// AliasTypeAddress answers an alias with the addresses of its target regardless of the alias-cname option.
+	AliasTypeAddress = "address"
+)
+
+type (
+	// Alias is the target of an alias along with the settings of the structured alias file formats.
+	Alias struct {
+		Target string
+		// Type is AliasTypeCNAME, AliasTypeAddress or empty to follow the alias-cname option.
+		Type string
+		// TTL of the records answering the alias, the default TTL is used if zero.
+		TTL     uint32
+		Tags    []string
+		Comment string
+		// Source is the file and line the alias is defined at.
+		Source string
+	}
+	// AliasDefinition is an alias along with the domain, wildcard or pattern it is defined for.
+	AliasDefinition struct {
+		Domain string
+		Alias
+	}
+	// aliasSet holds the aliases of the alias file.
+	// Lookups prefer exact aliases over wildcards, longer wildcards over shorter ones and wildcards over patterns,
+	// which are tried in file order.
+	aliasSet struct {
+		exact     map[string]Alias
+		wildcards []wildcardAlias
+		patterns  []patternAlias
+	}
+	wildcardAlias struct {
+		suffix string
+		alias  Alias
+	}
+	patternAlias struct {
+		pattern *regexp.Regexp
+		alias   Alias
+	}
+)
+
+func newAliasSet() aliasSet {
+	return aliasSet{exact: map[string]Alias{}}
+}
+
+// isStatic reports whether the alias resolves to static addresses rather than a name.
+func (a Alias) isStatic() bool {
+	_, ok := aliasTargetIPs(a.Target)
+
+	return ok
+}
+
+// ttl returns the TTL of the records answering the alias.
+func (a Alias) ttl() uint32 {
+	if a.TTL == 0 {
+		return recordTTL
+	}
+
+	return a.TTL
+}
+
+// add adds an alias for the given domain, which is either a fully qualified name,
+// a wildcard like *.app.test. or a regular expression enclosed in slashes like /(.+)\.app\.test\./.
+// Regular expressions are anchored to match the whole domain, the target may refer to submatches like $1.
+// Names and wildcards are case-insensitive, regular expressions are matched against the lowercased domain.
+func (s *aliasSet) add(domain string, alias Alias) error {
+	if err := validateAliasTarget(alias.Target); err != nil {
+		return err
+	}
+
+	if err := validateAliasType(alias.Type); err != nil {
+		return err
+	}
+
+	switch {
+	case isAliasPattern(domain):
+		pattern, err := regexp.Compile("^(?:" + domain[1:len(domain)-1] + ")$")
+		if err != nil {
+			return fmt.Errorf("%w '%s': %w", ErrInvalidAliasPattern, domain, err)
+		}
+
+		for i := range s.patterns {
+			if s.patterns[i].pattern.String() == pattern.String() {
+				s.patterns[i].alias = alias
+
+				return nil
+			}
+		}
+
+		s.patterns = append(s.patterns, patternAlias{pattern: pattern, alias: alias})
+	case strings.HasPrefix(domain, wildcardPrefix):
+		if err := validateFQDN(domain[len(wildcardPrefix):]); err != nil {
+			return err
+		}
+
+		suffix := dns.CanonicalName(domain[len(wildcardPrefix)-1:])
+		for i := range s.wildcards {
+			if s.wildcards[i].suffix == suffix {
+				s.wildcards[i].alias = alias
+
+				return nil
+			}
+		}
+
+		s.wildcards = append(s.wildcards, wildcardAlias{suffix: suffix, alias: alias})
+
+		sort.SliceStable(s.wildcards, func(i, j int) bool {
+			return len(s.wildcards[i].suffix) > len(s.wildcards[j].suffix)
+		})
+	default:
+		if err := validateFQDN(domain); err != nil {
+			return err
+		}
+
+		s.exact[dns.CanonicalName(domain)] = alias
+	}
+
+	return nil
+}
+
+func (s aliasSet) lookup(domain string) (Alias, bool) {
+	definition, ok := s.match(domain)
+
+	return definition.Alias, ok
+}
+
+// match returns the alias for domain along with the domain, wildcard or pattern it is defined for.
+// The target of a pattern is expanded with the submatches of domain.
+func (s aliasSet) match(domain string) (AliasDefinition, bool) {
+	domain = dns.CanonicalName(domain)
+
+	if alias, ok := s.exact[domain]; ok {
+		return AliasDefinition{Domain: domain, Alias: alias}, true
+	}
+
+	for _, wildcard := range s.wildcards {
+		if strings.HasSuffix(domain, wildcard.suffix) && len(domain) > len(wildcard.suffix) {
+			return AliasDefinition{Domain: wildcardPrefix[:1] + wildcard.suffix, Alias: wildcard.alias}, true
+		}
+	}
+
+	for _, p := range s.patterns {
+		if match := p.pattern.FindStringSubmatchIndex(domain); match != nil {
+			alias := p.alias
+			alias.Target = string(p.pattern.ExpandString(nil, alias.Target, domain, match))
+
+			return AliasDefinition{Domain: p.pattern.String(), Alias: alias}, true
+		}
+	}
+
+	return AliasDefinition{}, false
+}
+
+// resolve follows the chain of aliases starting at domain through at most maxDepth aliases and returns the first
+// alias with the target at the end of the chain. The settings of the first alias apply to the whole chain.
+func (s aliasSet) resolve(domain string, maxDepth int) (Alias, error) {
+	alias, ok := s.lookup(domain)
+	if !ok {
+		return Alias{}, ErrNoAlias
+	}
+
+	chain := []string{domain, alias.Target}
+
+	for depth := 1; !alias.isStatic(); depth++ {
+		next, ok := s.lookup(alias.Target)
+		if !ok {
+			break
+		}
+
+		if depth >= maxDepth {
+			return Alias{}, fmt.Errorf("%w, more than %d aliases: %s", ErrAliasDepthExceeded, maxDepth, strings.Join(chain, " -> "))
+		}
+
+		alias.Target = next.Target
+		chain = append(chain, next.Target)
+	}
+
+	return alias, nil
+}
+
+// definitions returns all aliases, exact ones sorted by domain followed by wildcards and patterns in lookup order.
+func (s aliasSet) definitions() []AliasDefinition {
+	definitions := make([]AliasDefinition, 0, s.len())
+
+	for _, domain := range s.exactDomains() {
+		definitions = append(definitions, AliasDefinition{Domain: domain, Alias: s.exact[domain]})
+	}
+
+	for _, wildcard := range s.wildcards {
+		definitions = append(definitions, AliasDefinition{Domain: wildcardPrefix[:1] + wildcard.suffix, Alias: wildcard.alias})
+	}
+
+	for _, p := range s.patterns {
+		definitions = append(definitions, AliasDefinition{Domain: p.pattern.String(), Alias: p.alias})
+	}
+
+	return definitions
+}
+
+func (s aliasSet) len() int {
+	return len(s.exact) + len(s.wildcards) + len(s.patterns)
+}
+
+func validateAliasTarget(target string) error {
+	if _, ok := aliasTargetIPs(target); ok {
+		return nil
+	}
+
+	if strings.Contains(target, ",") {
+		return fmt.Errorf("%w '%s': lists must contain ip addresses only", ErrInvalidAliasTarget, target)
+	}
+
+	return validateFQDN(target)
+}
+
+func validateAliasType(aliasType string) error {
+	switch aliasType {
+	case "", AliasTypeCNAME, AliasTypeAddress:
+		return nil
+	default:
+		return fmt.Errorf("%w '%s', expected '%s' or '%s'", ErrInvalidAliasType, aliasType, AliasTypeCNAME, AliasTypeAddress)
+	}
+}
+
+func validateFQDN(name string) error {
+	if _, ok := dns.IsDomainName(name); !ok {
+		return fmt.Errorf("%w '%s'", ErrInvalidAliasName, name)
+	}
+
+	if !dns.IsFqdn(name) {
+		return fmt.Errorf("%w: '%s', add a trailing dot", ErrNotFullyQualified, name)
+	}
+
+	return nil
+}
+
+// aliasTargetIPs returns the addresses of an alias target which is a comma separated list of ip addresses
+// rather than a name.
+func aliasTargetIPs(target string) ([]string, bool) {
+	ips := strings.Split(target, ",")
+	for _, ip := range ips {
+		if net.ParseIP(ip) == nil {
+			return nil, false
+		}
+	}
+
+	return ips, true
+}
+
+func isAliasPattern(domain string) bool {
+	const minPatternLength = 3
+
+	return len(domain) >= minPatternLength && strings.HasPrefix(domain, "/") && strings.HasSuffix(domain, "/")
+}
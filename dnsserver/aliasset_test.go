@@ -0,0 +1,181 @@
+package dnsserver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func newTestAliasSet(t *testing.T, targetsByDomain [][2]string) aliasSet {
+	t.Helper()
+
+	aliases := newAliasSet()
+
+	for _, alias := range targetsByDomain {
+		if err := aliases.add(alias[0], Alias{Target: alias[1]}); err != nil {
+			t.Fatalf("cannot add alias %s: %v", alias[0], err)
+		}
+	}
+
+	return aliases
+}
+
+func TestAliasSetLookup(t *testing.T) {
+	t.Parallel()
+
+	aliases := newTestAliasSet(t, [][2]string{
+		{`/(.+)\.app\.test\./`, "$1."},
+		{"*.test.", "any."},
+		{"*.app.test.", "app."},
+		{"api.app.test.", "api."},
+		{`/.*\.other\./`, "first."},
+		{`/x\.other\./`, "second."},
+	})
+
+	testCases := []struct {
+		domain string
+		target string
+	}{
+		{domain: "api.app.test.", target: "api."},
+		{domain: "API.App.Test.", target: "api."},
+		{domain: "web.app.test.", target: "app."},
+		{domain: "WEB.APP.TEST.", target: "app."},
+		{domain: "app.test.", target: "any."},
+		{domain: "x.other.", target: "first."},
+		{domain: "test."},
+		{domain: "pong."},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.domain, func(t *testing.T) {
+			t.Parallel()
+
+			alias, ok := aliases.lookup(testCase.domain)
+			if ok != (testCase.target != "") {
+				t.Fatalf("expected found=%v, got %v", testCase.target != "", ok)
+			}
+
+			if alias.Target != testCase.target {
+				t.Errorf("expected target %q, got %q", testCase.target, alias.Target)
+			}
+		})
+	}
+}
+
+func TestAliasSetLookupPatternSubmatch(t *testing.T) {
+	t.Parallel()
+
+	aliases := newTestAliasSet(t, [][2]string{{`/(.+)\.tenant\.test\./`, "$1.internal."}})
+
+	alias, ok := aliases.lookup("Shop.Tenant.test.")
+	if !ok || alias.Target != "shop.internal." {
+		t.Errorf("expected shop.internal., got %q %v", alias.Target, ok)
+	}
+}
+
+func TestAliasSetResolve(t *testing.T) {
+	t.Parallel()
+
+	aliases := newTestAliasSet(t, [][2]string{
+		{"a.test.", "b.test."},
+		{"b.test.", "c.test."},
+		{"c.test.", "pong."},
+		{"static.test.", "10.0.0.1"},
+		{"via-static.test.", "static.test."},
+	})
+
+	testCases := []struct {
+		domain   string
+		maxDepth int
+		target   string
+		err      error
+	}{
+		{domain: "c.test.", maxDepth: 8, target: "pong."},
+		{domain: "a.test.", maxDepth: 8, target: "pong."},
+		{domain: "a.test.", maxDepth: 3, target: "pong."},
+		{domain: "a.test.", maxDepth: 2, err: ErrAliasDepthExceeded},
+		{domain: "via-static.test.", maxDepth: 8, target: "10.0.0.1"},
+		{domain: "pong.", maxDepth: 8, err: ErrNoAlias},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.domain, func(t *testing.T) {
+			t.Parallel()
+
+			alias, err := aliases.resolve(testCase.domain, testCase.maxDepth)
+			if !errors.Is(err, testCase.err) {
+				t.Fatalf("expected error %v, got %v", testCase.err, err)
+			}
+
+			if alias.Target != testCase.target {
+				t.Errorf("expected target %q, got %q", testCase.target, alias.Target)
+			}
+		})
+	}
+}
+
+func TestAliasSetCycles(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		aliases [][2]string
+		cycles  []string
+	}{
+		{
+			name:    "no loop",
+			aliases: [][2]string{{"a.test.", "b.test."}, {"b.test.", "pong."}, {"*.x.test.", "a.test."}},
+		},
+		{
+			name:    "self",
+			aliases: [][2]string{{"a.test.", "a.test."}},
+			cycles:  []string{"a.test. -> a.test."},
+		},
+		{
+			name:    "exact aliases",
+			aliases: [][2]string{{"a.test.", "b.test."}, {"b.test.", "c.test."}, {"c.test.", "A.test."}},
+			cycles:  []string{"a.test. -> b.test. -> c.test. -> a.test."},
+		},
+		{
+			name:    "wildcard matching its target",
+			aliases: [][2]string{{"*.a.test.", "b.a.test."}},
+			cycles:  []string{"b.a.test. -> b.a.test."},
+		},
+		{
+			name:    "pattern matching its target",
+			aliases: [][2]string{{`/.*\.b\.test\./`, "x.b.test."}},
+			cycles:  []string{"x.b.test. -> x.b.test."},
+		},
+		{
+			name:    "through a wildcard",
+			aliases: [][2]string{{"*.a.test.", "x.test."}, {"x.test.", "y.a.test."}},
+			cycles:  []string{"x.test. -> y.a.test. -> x.test."},
+		},
+		{
+			name:    "growing through submatches",
+			aliases: [][2]string{{"a.test.", "x.y."}, {`/(.+)\.y\./`, "z.$1.y."}},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cycles []string
+
+			for _, cycle := range newTestAliasSet(t, testCase.aliases).cycles() {
+				cycles = append(cycles, strings.Join(cycle, " -> "))
+			}
+
+			if strings.Join(cycles, "\n") != strings.Join(testCase.cycles, "\n") {
+				t.Errorf("expected cycles %v, got %v", testCase.cycles, cycles)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package dnsserver
+
+import (
+	"errors"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AliasSnapshot is an immutable view of the aliases as loaded at one point in time.
+// It is safe for concurrent use, a reload replaces the snapshot instead of modifying it.
+type AliasSnapshot struct {
+	aliases  aliasSet
+	maxDepth int
+	// Version is incremented with every applied load, the empty snapshot before the first load has version 0.
+	Version uint64
+	// LoadedAt is the time the aliases were loaded, zero before the first load.
+	LoadedAt time.Time
+}
+
+func newAliasSnapshot(aliases aliasSet, maxDepth int, version uint64) *AliasSnapshot {
+	return &AliasSnapshot{
+		aliases:  aliases,
+		maxDepth: maxDepth,
+		Version:  version,
+		LoadedAt: time.Now(),
+	}
+}
+
+// GetAliasForDomain returns the final target of the alias chain starting at domain.
+func (s *AliasSnapshot) GetAliasForDomain(domain string) (string, bool) {
+	alias, ok := s.GetAlias(domain)
+
+	return alias.Target, ok
+}
+
+// GetAlias returns the alias defined for the domain including the settings of structured alias files.
+// If the target is an alias itself, the chain is followed and the final target returned.
+func (s *AliasSnapshot) GetAlias(domain string) (Alias, bool) {
+	alias, err := s.aliases.resolve(domain, s.maxDepth)
+	if errors.Is(err, ErrAliasDepthExceeded) {
+		logrus.Warnf("Cannot resolve alias: %v", err)
+	}
+
+	return alias, err == nil
+}
+
+// Len returns the number of aliases.
+func (s *AliasSnapshot) Len() int {
+	return s.aliases.len()
+}
+
+// Definitions returns all aliases along with the domain they are defined for.
+func (s *AliasSnapshot) Definitions() []AliasDefinition {
+	return s.aliases.definitions()
+}
@@ -0,0 +1,195 @@
+package dnsserver
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+var ErrAliasLoop = errors.New("alias loop")
+var ErrUnknownAliasTarget = errors.New("unknown alias target")
+
+// AliasFileReport lists the problems found in an alias file. Errors make the file unusable, warnings do not.
+type AliasFileReport struct {
+	Errors   []error
+	Warnings []error
+	// Aliases are the aliases defined by the alias files.
+	Aliases []AliasDefinition
+}
+
+func (r AliasFileReport) HasErrors() bool {
+	return len(r.Errors) > 0
+}
+
+// ValidateAliasFiles parses and merges the alias files the same way AliasFileLoader does and reports all problems
+// found. Directories are replaced by their files like the alias directory.
+// If knownNames is not nil, targets which are neither addresses nor among knownNames are reported as warnings.
+func ValidateAliasFiles(paths []string, knownNames []string) (AliasFileReport, error) {
+	var files []string
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return AliasFileReport{}, fmt.Errorf("cannot read alias file: %w", err)
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+
+			continue
+		}
+
+		dirFiles, err := aliasDirFiles(path)
+		if err != nil {
+			return AliasFileReport{}, err
+		}
+
+		files = append(files, dirFiles...)
+	}
+
+	aliases, report := parseAliasFiles(files)
+	report.Aliases = aliases.definitions()
+
+	if knownNames != nil {
+		report.Warnings = append(report.Warnings, aliases.unknownTargets(knownNames)...)
+	}
+
+	return report, nil
+}
+
+// loopErrors reports every alias loop with the file and line each member is defined at.
+func (s aliasSet) loopErrors() []error {
+	var errs []error
+
+	for _, cycle := range s.cycles() {
+		members := make([]string, len(cycle))
+		for i, name := range cycle {
+			members[i] = name
+			definition, ok := s.match(name)
+
+			switch {
+			case !ok || i == len(cycle)-1:
+			case definition.Domain != name:
+				members[i] = fmt.Sprintf("%s (%s at %s)", name, definition.Domain, definition.Source)
+			default:
+				members[i] = fmt.Sprintf("%s (%s)", name, definition.Source)
+			}
+		}
+
+		errs = append(errs, fmt.Errorf("%w: %s", ErrAliasLoop, strings.Join(members, " -> ")))
+	}
+
+	return errs
+}
+
+// cycles returns the alias loops reachable from the exact aliases and from the targets of wildcards and patterns,
+// each starting and ending with the same name. This covers wildcards and patterns whose target matches themselves,
+// loops through targets using submatches of a regular expression cannot be detected.
+// Without such targets a chain closes a loop after every alias has been passed once at most. Chains which
+// grow beyond that through submatches are not followed further, resolving them stops at the maximum depth.
+func (s aliasSet) cycles() [][]string {
+	var (
+		cycles [][]string
+		seen   = map[string]bool{}
+	)
+
+	for _, domain := range s.loopCandidates() {
+		path := []string{domain}
+		positions := map[string]int{domain: 0}
+
+		for name := domain; len(path) <= s.len(); {
+			alias, ok := s.lookup(name)
+			if !ok || alias.isStatic() {
+				break
+			}
+
+			target := dns.CanonicalName(alias.Target)
+
+			if start, visited := positions[target]; visited {
+				cycle := append(append([]string{}, path[start:]...), target)
+				if key := cycleKey(cycle); !seen[key] {
+					seen[key] = true
+					cycles = append(cycles, cycle)
+				}
+
+				break
+			}
+
+			positions[target] = len(path)
+			path = append(path, target)
+			name = target
+		}
+	}
+
+	return cycles
+}
+
+// loopCandidates returns the names an alias loop is searched from: the exact aliases and the
+// targets of wildcards and patterns, which are the names a query matching them continues with.
+func (s aliasSet) loopCandidates() []string {
+	candidates := s.exactDomains()
+
+	for _, wildcard := range s.wildcards {
+		if !wildcard.alias.isStatic() {
+			candidates = append(candidates, dns.CanonicalName(wildcard.alias.Target))
+		}
+	}
+
+	for _, p := range s.patterns {
+		if !p.alias.isStatic() && !strings.Contains(p.alias.Target, "$") {
+			candidates = append(candidates, dns.CanonicalName(p.alias.Target))
+		}
+	}
+
+	return candidates
+}
+
+// cycleKey identifies a cycle independent of the member it starts with.
+func cycleKey(cycle []string) string {
+	members := append([]string{}, cycle[:len(cycle)-1]...)
+	sort.Strings(members)
+
+	return strings.Join(members, " ")
+}
+
+// unknownTargets reports targets that are neither addresses nor known names.
+// Targets using submatches of a regular expression cannot be checked.
+func (s aliasSet) unknownTargets(knownNames []string) []error {
+	known := map[string]bool{}
+	for _, name := range knownNames {
+		known[dns.CanonicalName(name)] = true
+	}
+
+	var warnings []error
+
+	for _, definition := range s.definitions() {
+		target := definition.Target
+		if definition.isStatic() || known[dns.CanonicalName(target)] || strings.Contains(target, "$") {
+			continue
+		}
+
+		if _, isAlias := s.lookup(target); isAlias {
+			continue
+		}
+
+		warnings = append(warnings, fmt.Errorf("%w '%s' of '%s' (%s), it is no container name",
+			ErrUnknownAliasTarget, target, definition.Domain, definition.Source))
+	}
+
+	return warnings
+}
+
+func (s aliasSet) exactDomains() []string {
+	domains := make([]string, 0, len(s.exact))
+	for domain := range s.exact {
+		domains = append(domains, domain)
+	}
+
+	sort.Strings(domains)
+
+	return domains
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Oppodelldog/docker-dns/dnsserver"
+)
+
+var ErrUnknownConfigKey = errors.New("unknown config key")
+var ErrInvalidConfigValue = errors.New("invalid config value")
+
+const envConfigFile = "DOCKER_DNS_CONFIG"
+
+const (
+	optionListen            = "listen"
+	optionForward           = "forward"
+	optionUpstreams         = "upstreams"
+	optionUpstreamTimeout   = "upstream-timeout"
+	optionZone              = "zone"
+	optionNegativeTTL       = "negative-ttl"
+	optionAliasCNAME        = "alias-cname"
+	optionStatusListen      = "status-listen"
+	optionResyncOnReload    = "resync-on-reload"
+	optionAliasDepth        = "alias-depth"
+	optionReconcile         = "reconcile-interval"
+	optionWithdrawPaused    = "withdraw-paused"
+	optionWithdrawUnhealthy = "withdraw-unhealthy"
+)
+
+type option struct {
+	name   string
+	env    string
+	usage  string
+	isBool bool
+}
+
+// options can be set in the config file, by environment variable or by flag, in ascending precedence.
+var options = []option{
+	{name: optionListen, env: "DOCKER_DNS_LISTEN", usage: "listen address [udp://|tcp://]host[:port], repeatable"},
+	{name: optionForward, env: "DOCKER_DNS_FORWARD", usage: "forward unknown names to upstream resolvers", isBool: true},
+	{name: optionUpstreams, env: "DOCKER_DNS_UPSTREAMS", usage: "upstream resolver host[:port], repeatable"},
+	{name: optionUpstreamTimeout, env: "DOCKER_DNS_UPSTREAM_TIMEOUT", usage: "timeout per upstream resolver"},
+	{name: optionZone, env: "DOCKER_DNS_ZONE", usage: "zone docker-dns is authoritative for"},
+	{name: optionNegativeTTL, env: "DOCKER_DNS_NEGATIVE_TTL", usage: "negative caching TTL inside the zone"},
+	{name: optionAliasCNAME, env: "DOCKER_DNS_ALIAS_CNAME", usage: "answer aliases with a CNAME record", isBool: true},
+	{name: optionAliasDepth, env: "DOCKER_DNS_ALIAS_DEPTH", usage: "maximum number of aliases followed in a chain"},
+	{name: optionStatusListen, env: "DOCKER_DNS_STATUS_LISTEN", usage: "address of the HTTP status endpoint, e.g. :8053"},
+	{name: optionReconcile, env: "DOCKER_DNS_RECONCILE_INTERVAL", usage: "interval to reconcile containers in, negative disables"},
+	{name: optionWithdrawPaused, env: "DOCKER_DNS_WITHDRAW_PAUSED", usage: "withdraw paused containers", isBool: true},
+	{name: optionWithdrawUnhealthy, env: "DOCKER_DNS_WITHDRAW_UNHEALTHY", usage: "withdraw unhealthy containers", isBool: true},
+	{name: optionResyncOnReload, env: "DOCKER_DNS_RESYNC_ON_RELOAD", usage: "resync containers on reload", isBool: true},
+}
+
+// listFlag collects the values of a flag that may be given multiple times or as a comma separated list.
+type listFlag struct {
+	values []string
+	isBool bool
+}
+
+func (f *listFlag) String() string {
+	if f == nil {
+		return ""
+	}
+
+	return strings.Join(f.values, ",")
+}
+
+func (f *listFlag) Set(value string) error {
+	f.values = append(f.values, splitList(value)...)
+
+	return nil
+}
+
+func (f *listFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+func getConfig(args []string) (dnsserver.Config, error) {
+	flags := flag.NewFlagSet("dnsserver", flag.ContinueOnError)
+	configFile := flags.String("config", os.Getenv(envConfigFile), "path to a JSON config file")
+
+	flagValues := map[string]*listFlag{}
+	for _, o := range options {
+		flagValues[o.name] = &listFlag{isBool: o.isBool}
+		flags.Var(flagValues[o.name], o.name, fmt.Sprintf("%s (env %s)", o.usage, o.env))
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return dnsserver.Config{}, fmt.Errorf("cannot parse flags: %w", err)
+	}
+
+	values := map[string][]string{}
+
+	if *configFile != "" {
+		if err := readConfigFile(*configFile, values); err != nil {
+			return dnsserver.Config{}, err
+		}
+	}
+
+	for _, o := range options {
+		if value, ok := os.LookupEnv(o.env); ok {
+			values[o.name] = splitList(value)
+		}
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		if v, ok := flagValues[f.Name]; ok {
+			values[f.Name] = v.values
+		}
+	})
+
+	return newConfig(values)
+}
+
+func readConfigFile(path string, values map[string][]string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+
+	var fileValues map[string]interface{}
+	if err := json.Unmarshal(content, &fileValues); err != nil {
+		return fmt.Errorf("cannot parse config file '%s': %w", path, err)
+	}
+
+	for key, value := range fileValues {
+		if !isOption(key) {
+			return fmt.Errorf("%w '%s' in config file '%s'", ErrUnknownConfigKey, key, path)
+		}
+
+		switch v := value.(type) {
+		case string:
+			values[key] = []string{v}
+		case bool:
+			values[key] = []string{strconv.FormatBool(v)}
+		case float64:
+			values[key] = []string{strconv.FormatFloat(v, 'f', -1, 64)}
+		case []interface{}:
+			values[key] = nil
+			for _, item := range v {
+				values[key] = append(values[key], fmt.Sprint(item))
+			}
+		default:
+			return fmt.Errorf("%w for '%s' in config file '%s'", ErrInvalidConfigValue, key, path)
+		}
+	}
+
+	return nil
+}
+
+func newConfig(values map[string][]string) (dnsserver.Config, error) {
+	var (
+		config = dnsserver.Config{Upstreams: values[optionUpstreams]}
+		err    error
+	)
+
+	for _, value := range values[optionListen] {
+		addresses, err := dnsserver.ParseListenAddress(value)
+		if err != nil {
+			return dnsserver.Config{}, fmt.Errorf("%w: %w", ErrInvalidConfigValue, err)
+		}
+
+		config.Listen = append(config.Listen, addresses...)
+	}
+
+	if config.Forward, err = parseBool(values, optionForward); err != nil {
+		return dnsserver.Config{}, err
+	}
+
+	if config.AliasCNAME, err = parseBool(values, optionAliasCNAME); err != nil {
+		return dnsserver.Config{}, err
+	}
+
+	if config.Policy.WithdrawPaused, err = parseBool(values, optionWithdrawPaused); err != nil {
+		return dnsserver.Config{}, err
+	}
+
+	if config.Policy.WithdrawUnhealthy, err = parseBool(values, optionWithdrawUnhealthy); err != nil {
+		return dnsserver.Config{}, err
+	}
+
+	if config.ResyncOnReload, err = parseBool(values, optionResyncOnReload); err != nil {
+		return dnsserver.Config{}, err
+	}
+
+	if config.AliasDepth, err = parseInt(values, optionAliasDepth); err != nil {
+		return dnsserver.Config{}, err
+	}
+
+	if config.UpstreamTimeout, err = parseDuration(values, optionUpstreamTimeout); err != nil {
+		return dnsserver.Config{}, err
+	}
+
+	if config.ReconcileInterval, err = parseDuration(values, optionReconcile); err != nil {
+		return dnsserver.Config{}, err
+	}
+
+	if config.NegativeTTL, err = parseDuration(values, optionNegativeTTL); err != nil {
+		return dnsserver.Config{}, err
+	}
+
+	if zone := values[optionZone]; len(zone) > 0 {
+		config.Zone = zone[len(zone)-1]
+	}
+
+	if statusListen := values[optionStatusListen]; len(statusListen) > 0 {
+		config.StatusListen = statusListen[len(statusListen)-1]
+	}
+
+	return config, nil
+}
+
+func parseBool(values map[string][]string, key string) (bool, error) {
+	value := values[key]
+	if len(value) == 0 {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(value[len(value)-1])
+	if err != nil {
+		return false, fmt.Errorf("%w for %s: %w", ErrInvalidConfigValue, key, err)
+	}
+
+	return b, nil
+}
+
+func parseInt(values map[string][]string, key string) (int, error) {
+	value := values[key]
+	if len(value) == 0 {
+		return 0, nil
+	}
+
+	i, err := strconv.Atoi(value[len(value)-1])
+	if err != nil {
+		return 0, fmt.Errorf("%w for %s: %w", ErrInvalidConfigValue, key, err)
+	}
+
+	return i, nil
+}
+
+func parseDuration(values map[string][]string, key string) (time.Duration, error) {
+	value := values[key]
+	if len(value) == 0 {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(value[len(value)-1])
+	if err != nil {
+		return 0, fmt.Errorf("%w for %s: %w", ErrInvalidConfigValue, key, err)
+	}
+
+	return d, nil
+}
+
+func isOption(name string) bool {
+	for _, o := range options {
+		if o.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func splitList(value string) []string {
+	var values []string
+
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"os"
 	"os/signal"
 	"syscall"
@@ -15,21 +17,60 @@ import (
 func main() {
 	logrus.SetLevel(logrus.DebugLevel)
 
+	if len(os.Args) > 1 && os.Args[1] == validateCommand {
+		os.Exit(runValidate(os.Args[2:]))
+	}
+
+	config, err := getConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+
+	if err != nil {
+		logrus.Fatalf("invalid configuration: %v", err)
+	}
+
 	ctx := getContextCanceledByInterrupt()
+	hangups := notifyHangup(ctx)
 
 	dockerClient, dockerClientDefer := getDockerClient()
 	defer dockerClientDefer()
 
 	dockerClientAdapter := dnsserver.NewDockerClientAdapter(dockerClient)
 
-	aliasProvider := dnsserver.NewAliasFileLoader(ctx)
+	aliasProvider := dnsserver.NewAliasFileLoader(ctx, config.AliasDepth)
 	dnsRegistry := dnsserver.NewDNSRegistry(aliasProvider)
 
-	containerRegisterer := dnsserver.NewContainerRegistry(dnsRegistry)
+	containerRegisterer := dnsserver.NewContainerRegistry(dnsRegistry, config.Policy)
+
+	survey := dnsserver.NewContainerDNSSurvey(
+		containerRegisterer, dockerClientAdapter, dockerClientAdapter, dockerClientAdapter,
+	)
+	survey.Run()
+
+	var resyncer dnsserver.ContainerResyncer
+	if config.ResyncOnReload {
+		resyncer = survey
+	}
+
+	reloader := dnsserver.NewReloader(aliasProvider, resyncer)
+	reloadOnHangup(ctx, hangups, reloader)
+
+	updater := dnsserver.NewDNSUpdater(ctx, dockerClient, dockerClientAdapter, containerRegisterer, survey)
+
+	var reconcileMonitor dnsserver.ReconcileMonitor
+	if interval := config.ReconcileIntervalOrDefault(); interval > 0 {
+		reconciler := dnsserver.NewReconciler(survey, interval)
+		reconciler.Start(ctx)
+		reconcileMonitor = reconciler
+	}
+
+	if config.StatusListen != "" {
+		statusHandler := dnsserver.NewStatusHandler(reloader, updater, reconcileMonitor)
+		dnsserver.RunStatusServer(ctx, config.StatusListen, statusHandler)
+	}
 
-	dnsserver.NewContainerDNSSurvey(containerRegisterer, dockerClientAdapter, dockerClientAdapter).Run()
-	dnsserver.NewDNSUpdater(ctx, dockerClient, dockerClientAdapter, containerRegisterer)
-	dnsserver.Run(ctx, dnsRegistry)
+	dnsserver.Run(ctx, dnsRegistry, config)
 }
 
 func getDockerClient() (*client.Client, func()) {
@@ -55,3 +96,31 @@ func getContextCanceledByInterrupt() context.Context {
 
 	return ctx
 }
+
+// notifyHangup catches SIGHUP right away, so that it does not terminate the process before reloading is set up.
+func notifyHangup(ctx context.Context) <-chan os.Signal {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	go func() {
+		<-ctx.Done()
+		signal.Stop(signals)
+	}()
+
+	return signals
+}
+
+// reloadOnHangup reloads whenever SIGHUP is received until ctx is done.
+func reloadOnHangup(ctx context.Context, hangups <-chan os.Signal, reloader dnsserver.Reloader) {
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hangups:
+				logrus.Info("Reloading due to SIGHUP")
+				reloader.Reload()
+			}
+		}
+	}()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Oppodelldog/docker-dns/dnsserver"
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+)
+
+const validateCommand = "validate"
+
+const (
+	exitValid   = 0
+	exitInvalid = 1
+	exitUsage   = 2
+)
+
+// runValidate checks alias files and prints all errors and warnings.
+// It returns a non-zero exit code if the files have errors, or warnings in strict mode.
+func runValidate(args []string) int {
+	flags := flag.NewFlagSet(validateCommand, flag.ContinueOnError)
+	strict := flags.Bool("strict", false, "treat warnings as errors")
+	checkContainers := flags.Bool("containers", true, "warn about targets which are no names of docker containers")
+	list := flags.Bool("list", false, "print all aliases along with the file they are defined in")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s %s [flags] [alias file or directory...]\n", os.Args[0], validateCommand)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitValid
+		}
+
+		return exitUsage
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		discovered, err := dnsserver.DiscoverAliasFiles()
+		if err != nil {
+			fmt.Println(err)
+
+			return exitUsage
+		}
+
+		paths = discovered
+	}
+
+	var knownNames []string
+
+	if *checkContainers {
+		names, err := getContainerDNSNames()
+		if err != nil {
+			fmt.Printf("skipping container name check: %v\n", err)
+		}
+
+		knownNames = names
+	}
+
+	report, err := dnsserver.ValidateAliasFiles(paths, knownNames)
+	if err != nil {
+		fmt.Println(err)
+
+		return exitInvalid
+	}
+
+	if *list {
+		for _, alias := range report.Aliases {
+			fmt.Printf("%s: %s -> %s\n", alias.Source, alias.Domain, alias.Target)
+		}
+	}
+
+	for _, err := range report.Errors {
+		printProblem("error", err)
+	}
+
+	for _, warning := range report.Warnings {
+		printProblem("warning", warning)
+	}
+
+	fmt.Printf("%d aliases, %d errors, %d warnings\n", len(report.Aliases), len(report.Errors), len(report.Warnings))
+
+	if report.HasErrors() || (*strict && len(report.Warnings) > 0) {
+		return exitInvalid
+	}
+
+	return exitValid
+}
+
+// printProblem prints the problem prefixed with the file and line it was found at, if known.
+func printProblem(severity string, err error) {
+	var lineErr dnsserver.AliasLineError
+	if errors.As(err, &lineErr) && lineErr.File != "" {
+		fmt.Printf("%s:%d: %s: %v\n", lineErr.File, lineErr.Line, severity, lineErr.Err)
+
+		return
+	}
+
+	fmt.Printf("%s: %v\n", severity, err)
+}
+
+// getContainerDNSNames returns the names of all containers. Unlike the server, it reports a docker client which
+// cannot be created as error, so that the container name check is skipped.
+func getContainerDNSNames() ([]string, error) {
+	dockerClient, err := client.NewClientWithOpts(client.FromEnv)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create docker client: %w", err)
+	}
+
+	defer func() {
+		if err := dockerClient.Close(); err != nil {
+			logrus.Errorf("error closing docker client: %v", err)
+		}
+	}()
+
+	names, err := dnsserver.NewDockerClientAdapter(dockerClient).GetContainerDNSNames()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get container names: %w", err)
+	}
+
+	return names, nil
+}
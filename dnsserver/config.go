@@ -0,0 +1,53 @@
+package dnsserver
+
+import "time"
+
+// Config holds the settings of the DNS server.
+type Config struct {
+	// Listen are the addresses the server listens on. If empty, DefaultListenAddresses are used.
+	Listen []ListenAddress
+	// Forward enables relaying queries for names unknown to docker-dns to the upstream resolvers.
+	Forward bool
+	// Upstreams are the resolvers queries are forwarded to, as host or host:port.
+	// If empty, the nameservers of /etc/resolv.conf are used.
+	Upstreams []string
+	// UpstreamTimeout limits the time to wait for a single upstream to answer.
+	UpstreamTimeout time.Duration
+	// Zone is the domain docker-dns is authoritative for, e.g. "docker.".
+	// Missing names inside the zone are answered with NXDOMAIN. Empty disables the zone.
+	Zone string
+	// NegativeTTL is the time resolvers may cache negative answers for names inside the zone.
+	NegativeTTL time.Duration
+	// AliasCNAME answers queries for aliases with a CNAME to the container name instead of its addresses.
+	AliasCNAME bool
+	// AliasDepth is the maximum number of aliases followed when an alias targets another alias.
+	// If not positive, a default depth is used.
+	AliasDepth int
+	// StatusListen is the address of the HTTP status endpoint, e.g. ":8053". Empty disables the endpoint.
+	StatusListen string
+	// ResyncOnReload resyncs the containers with docker whenever the aliases are reloaded by SIGHUP
+	// or the status endpoint.
+	ResyncOnReload bool
+	// ReconcileInterval is the interval the registry is reconciled with the running containers in.
+	// Zero uses a default interval, a negative interval disables reconciliation.
+	ReconcileInterval time.Duration
+	// Policy decides which running containers are served, e.g. to withdraw paused or unhealthy containers.
+	Policy ContainerPolicy
+}
+
+// ReconcileIntervalOrDefault returns the interval to reconcile in, which is not positive if reconciliation is disabled.
+func (c Config) ReconcileIntervalOrDefault() time.Duration {
+	if c.ReconcileInterval == 0 {
+		return defaultReconcileInterval
+	}
+
+	return c.ReconcileInterval
+}
+
+func (c Config) listenAddresses() []ListenAddress {
+	if len(c.Listen) == 0 {
+		return DefaultListenAddresses()
+	}
+
+	return c.Listen
+}
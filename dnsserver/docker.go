@@ -3,21 +3,43 @@ package dnsserver
 import (
 	"context"
 	"fmt"
+	"sort"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
+	"github.com/miekg/dns"
 	"github.com/sirupsen/logrus"
 )
 
+// shortContainerIDLength is the length of the abbreviated container ids shown by docker.
+const shortContainerIDLength = 12
+
 type (
 	RunningContainersGetter interface {
 		GetRunningContainers() ([]types.Container, error)
 	}
 	NetworkIDsGetter interface {
-		GetNetworkIDs() ([]string, error)
+		GetNetworkIDs(runningContainers []types.Container) ([]string, error)
 	}
+	// NetworkIPsGetter returns the addresses of containers in the networks they share with docker-dns.
+	// The shared networks are determined once per pass and passed to every container.
 	NetworkIPsGetter interface {
-		GetContainerNetworkIps(container types.Container) []string
+		NetworkIDsGetter
+		GetContainerNetworkIps(container types.Container, networkIDs []string) []string
+	}
+	ContainerInspector interface {
+		InspectContainer(container types.Container, networkIDs []string) ContainerDetails
+	}
+	// ContainerDetails are the details of a container which are only available by inspecting it.
+	ContainerDetails struct {
+		NetworkAliases []NetworkAlias
+		// Health is the state of the container's healthcheck, nil if the container has no healthcheck.
+		Health *types.Health
+	}
+	// NetworkAlias is a network scoped alias of a container and its addresses in the networks defining the alias.
+	NetworkAlias struct {
+		Name string
+		IPs  []string
 	}
 	DockerClientAdapter struct {
 		dockerClient *client.Client
@@ -41,24 +63,94 @@ func (a DockerClientAdapter) GetRunningContainers() ([]types.Container, error) {
 	return containers, nil
 }
 
-func (a DockerClientAdapter) getNetworkIDs() ([]string, error) {
-	var networkIDs []string
+// GetContainerDNSNames returns the DNS names of all containers, running or not,
+// as derived from their names, docker-dns.names labels and network aliases in any network.
+func (a DockerClientAdapter) GetContainerDNSNames() ([]string, error) {
+	containers, err := a.dockerClient.ContainerList(context.Background(), types.ContainerListOptions{All: true})
+	if err != nil {
+		return nil, fmt.Errorf("cannot get containers: %w", err)
+	}
+
+	names := make([]string, 0, len(containers))
+
+	for _, container := range containers {
+		for _, containerName := range container.Names {
+			names = append(names, normalizeContainerName(containerName))
+		}
 
+		names = append(names, labelNames(container)...)
+
+		inspect, err := a.dockerClient.ContainerInspect(context.Background(), container.ID)
+		if err != nil {
+			return nil, fmt.Errorf("cannot inspect container %s: %w", container.ID, err)
+		}
+
+		if inspect.NetworkSettings == nil {
+			continue
+		}
+
+		for _, endpoint := range inspect.NetworkSettings.Networks {
+			if endpoint == nil {
+				continue
+			}
+
+			for _, alias := range endpoint.Aliases {
+				if alias != shortContainerID(container.ID) {
+					names = append(names, dns.Fqdn(alias))
+				}
+			}
+		}
+	}
+
+	return names, nil
+}
+
+// IsOwnContainer reports whether the container is the one docker-dns runs in, judged by its addresses.
+func (a DockerClientAdapter) IsOwnContainer(container types.Container) bool {
 	myIps, err := getIps()
 	if err != nil {
-		return nil, err
+		logrus.Errorf("error retrieving own ips: %v", err)
+
+		return false
 	}
 
+	for _, containerNetwork := range container.NetworkSettings.Networks {
+		for _, ip := range myIps {
+			if containerNetwork.IPAddress == ip.String() || containerNetwork.GlobalIPv6Address == ip.String() {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (a DockerClientAdapter) getNetworkIDs() ([]string, error) {
 	containers, err := a.GetRunningContainers()
 	if err != nil {
 		return nil, err
 	}
 
-	for _, container := range containers {
+	return a.GetNetworkIDs(containers)
+}
+
+// GetNetworkIDs returns the ids of the networks docker-dns is attached to, judged by which of the running
+// containers has the addresses of docker-dns.
+func (a DockerClientAdapter) GetNetworkIDs(runningContainers []types.Container) ([]string, error) {
+	var networkIDs []string
+
+	myIps, err := getIps()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, container := range runningContainers {
 		for _, containerNetwork := range container.NetworkSettings.Networks {
 			for _, ip := range myIps {
-				if containerNetwork.IPAddress == ip.String() {
+				if containerNetwork.IPAddress == ip.String() || containerNetwork.GlobalIPv6Address == ip.String() {
 					networkIDs = append(networkIDs, containerNetwork.NetworkID)
+
+					break
 				}
 			}
 		}
@@ -67,23 +159,100 @@ func (a DockerClientAdapter) getNetworkIDs() ([]string, error) {
 	return networkIDs, nil
 }
 
-func (a DockerClientAdapter) GetContainerNetworkIps(container types.Container) []string {
+// GetContainerNetworkIps returns the IPv4 and IPv6 addresses of the given container in the given networks,
+// which are the networks it shares with docker-dns.
+func (a DockerClientAdapter) GetContainerNetworkIps(container types.Container, networkIDs []string) []string {
 	var ips []string
 
-	networkIDs, err := a.getNetworkIDs()
+	for _, containerNetwork := range container.NetworkSettings.Networks {
+		for _, myNetwork := range networkIDs {
+			if containerNetwork.NetworkID != myNetwork {
+				continue
+			}
+
+			if containerNetwork.IPAddress != "" {
+				ips = append(ips, containerNetwork.IPAddress)
+			}
+
+			if containerNetwork.GlobalIPv6Address != "" {
+				ips = append(ips, containerNetwork.GlobalIPv6Address)
+			}
+		}
+	}
+
+	return ips
+}
+
+// InspectContainer returns the health of the container and the aliases the container has in the given networks,
+// which are the networks it shares with docker-dns, each resolving to the container's addresses in the networks
+// the alias is defined for.
+func (a DockerClientAdapter) InspectContainer(container types.Container, networkIDs []string) ContainerDetails {
+	inspect, err := a.dockerClient.ContainerInspect(context.Background(), container.ID)
 	if err != nil {
-		logrus.Errorf("error retrieving all NetworkIDs: %v", err)
+		logrus.Errorf("error inspecting container %s: %v", container.ID, err)
+
+		return ContainerDetails{}
+	}
+
+	var details ContainerDetails
+
+	if inspect.ContainerJSONBase != nil && inspect.State != nil {
+		details.Health = inspect.State.Health
+	}
+
+	details.NetworkAliases = networkAliases(container, inspect, networkIDs)
 
+	return details
+}
+
+func networkAliases(container types.Container, inspect types.ContainerJSON, networkIDs []string) []NetworkAlias {
+	if inspect.NetworkSettings == nil {
 		return nil
 	}
 
-	for _, containerNetwork := range container.NetworkSettings.Networks {
-		for _, myNetwork := range networkIDs {
-			if containerNetwork.NetworkID == myNetwork {
-				ips = append(ips, containerNetwork.IPAddress)
+	ipsByAlias := map[string][]string{}
+
+	for _, endpoint := range inspect.NetworkSettings.Networks {
+		if endpoint == nil || !containsString(networkIDs, endpoint.NetworkID) {
+			continue
+		}
+
+		for _, alias := range endpoint.Aliases {
+			// docker adds the short container id as alias to every network
+			if alias == shortContainerID(container.ID) {
+				continue
 			}
+
+			name := dns.Fqdn(alias)
+			ipsByAlias[name] = append(ipsByAlias[name], endpoint.IPAddress, endpoint.GlobalIPv6Address)
 		}
 	}
 
-	return ips
+	aliases := make([]NetworkAlias, 0, len(ipsByAlias))
+	for name, ips := range ipsByAlias {
+		aliases = append(aliases, NetworkAlias{Name: name, IPs: selectAddresses(ips)})
+	}
+
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+
+	return aliases
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// shortContainerID returns the abbreviated container id docker uses as network alias.
+func shortContainerID(containerID string) string {
+	if len(containerID) <= shortContainerIDLength {
+		return containerID
+	}
+
+	return containerID[:shortContainerIDLength]
 }
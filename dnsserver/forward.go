@@ -0,0 +1,164 @@
+package dnsserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+)
+
+const resolvConfPath = "/etc/resolv.conf"
+const dockerEmbeddedDNS = "127.0.0.11"
+const defaultUpstreamTimeout = 2 * time.Second
+
+var ErrNoUpstreamAnswered = errors.New("no upstream resolver answered")
+
+type QueryForwarder interface {
+	Forward(r *dns.Msg) (*dns.Msg, error)
+}
+
+// Forwarder relays DNS queries to a list of upstream resolvers, trying them in order until one answers.
+type Forwarder struct {
+	upstreams []string
+	udpClient *dns.Client
+	tcpClient *dns.Client
+}
+
+// NewForwarder returns a new Forwarder for the configured upstreams.
+// If no upstreams are configured, the nameservers of /etc/resolv.conf are used, falling back to Docker's embedded DNS.
+func NewForwarder(config Config) Forwarder {
+	upstreams := config.Upstreams
+	if len(upstreams) == 0 {
+		upstreams = defaultUpstreams(config.listenAddresses())
+	}
+
+	timeout := config.UpstreamTimeout
+	if timeout <= 0 {
+		timeout = defaultUpstreamTimeout
+	}
+
+	normalized := make([]string, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		normalized = append(normalized, normalizeUpstream(upstream))
+	}
+
+	logrus.Infof("forwarding unknown names to %v", normalized)
+
+	return Forwarder{
+		upstreams: normalized,
+		udpClient: &dns.Client{Net: "udp", Timeout: timeout},
+		tcpClient: &dns.Client{Net: "tcp", Timeout: timeout},
+	}
+}
+
+// Forward sends the query to the upstreams in order and returns the first response received.
+// The response, including its RCODE, is returned as the upstream sent it.
+func (f Forwarder) Forward(r *dns.Msg) (*dns.Msg, error) {
+	for _, upstream := range f.upstreams {
+		resp, err := f.exchange(r, upstream)
+		if err != nil {
+			logrus.Warnf("upstream %s failed: %v", upstream, err)
+
+			continue
+		}
+
+		return resp, nil
+	}
+
+	return nil, fmt.Errorf("%w for %s", ErrNoUpstreamAnswered, r.Question[0].Name)
+}
+
+func (f Forwarder) exchange(r *dns.Msg, upstream string) (*dns.Msg, error) {
+	resp, _, err := f.udpClient.Exchange(r, upstream)
+	if err != nil {
+		return nil, fmt.Errorf("cannot exchange via udp: %w", err)
+	}
+
+	if resp.Truncated {
+		resp, _, err = f.tcpClient.Exchange(r, upstream)
+		if err != nil {
+			return nil, fmt.Errorf("cannot exchange via tcp: %w", err)
+		}
+	}
+
+	return resp, nil
+}
+
+func defaultUpstreams(listenAddresses []ListenAddress) []string {
+	var upstreams []string
+
+	config, err := dns.ClientConfigFromFile(resolvConfPath)
+	if err != nil {
+		logrus.Warnf("cannot read %s: %v", resolvConfPath, err)
+	} else {
+		for _, server := range config.Servers {
+			upstream := net.JoinHostPort(server, config.Port)
+			if isOwnAddress(upstream, listenAddresses) {
+				logrus.Debugf("skipping upstream %s, it is docker-dns itself", upstream)
+
+				continue
+			}
+
+			upstreams = append(upstreams, upstream)
+		}
+	}
+
+	if len(upstreams) == 0 {
+		upstreams = append(upstreams, dockerEmbeddedDNS)
+	}
+
+	return upstreams
+}
+
+// isOwnAddress reports whether the upstream points to docker-dns itself, which would make queries loop.
+func isOwnAddress(upstream string, listenAddresses []ListenAddress) bool {
+	host, port, err := net.SplitHostPort(upstream)
+	if err != nil {
+		return false
+	}
+
+	for _, address := range listenAddresses {
+		listenHost, listenPort, err := net.SplitHostPort(address.Addr)
+		if err != nil || listenPort != port {
+			continue
+		}
+
+		if listenHost == host {
+			return true
+		}
+
+		listensOnAllInterfaces := listenHost == "" || net.ParseIP(listenHost).IsUnspecified()
+		if listensOnAllInterfaces && isInterfaceAddress(host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isInterfaceAddress(host string) bool {
+	myIps, err := getIps()
+	if err != nil {
+		return false
+	}
+
+	for _, ip := range myIps {
+		if ip.String() == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+func normalizeUpstream(upstream string) string {
+	if _, _, err := net.SplitHostPort(upstream); err == nil {
+		return upstream
+	}
+
+	return net.JoinHostPort(upstream, strconv.Itoa(dnsPort))
+}
@@ -0,0 +1,148 @@
+package dnsserver
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const testUpstreamTimeout = 500 * time.Millisecond
+
+// startUpstream starts a DNS server on a free local UDP port answering every A query with 192.0.2.1
+// and every other query with NXDOMAIN.
+func startUpstream(t *testing.T) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: conn, NotifyStartedFunc: func() { close(started) }}
+	server.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		msg := &dns.Msg{}
+		msg.SetReply(r)
+
+		if r.Question[0].Qtype == dns.TypeA {
+			msg.Answer = append(msg.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: recordTTL},
+				A:   net.IPv4(192, 0, 2, 1),
+			})
+		} else {
+			msg.Rcode = dns.RcodeNameError
+		}
+
+		_ = w.WriteMsg(msg)
+	})
+
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+
+	<-started
+
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	return conn.LocalAddr().String()
+}
+
+// unusedUpstream returns a local UDP address nothing listens on.
+func unusedUpstream(t *testing.T) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+
+	address := conn.LocalAddr().String()
+
+	if err := conn.Close(); err != nil {
+		t.Fatalf("cannot close: %v", err)
+	}
+
+	return address
+}
+
+func TestForwarderFailover(t *testing.T) {
+	t.Parallel()
+
+	forwarder := NewForwarder(Config{
+		Upstreams:       []string{unusedUpstream(t), startUpstream(t)},
+		UpstreamTimeout: testUpstreamTimeout,
+	})
+
+	r := &dns.Msg{}
+	r.SetQuestion("example.com.", dns.TypeMX)
+
+	resp, err := forwarder.Forward(r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if resp.Rcode != dns.RcodeNameError {
+		t.Errorf("expected the rcode of the upstream, got %s", dns.RcodeToString[resp.Rcode])
+	}
+}
+
+func TestForwarderNoUpstreamAnswered(t *testing.T) {
+	t.Parallel()
+
+	forwarder := NewForwarder(Config{Upstreams: []string{unusedUpstream(t)}, UpstreamTimeout: testUpstreamTimeout})
+
+	r := &dns.Msg{}
+	r.SetQuestion("example.com.", dns.TypeA)
+
+	if _, err := forwarder.Forward(r); !errors.Is(err, ErrNoUpstreamAnswered) {
+		t.Errorf("expected %v, got %v", ErrNoUpstreamAnswered, err)
+	}
+}
+
+func TestDNSHandlerForward(t *testing.T) {
+	t.Parallel()
+
+	registry := newTestRegistry(newAliasSet())
+	registerTestContainer(registry, "a", "web.", "10.0.0.2")
+
+	testCases := []struct {
+		name      string
+		upstreams []string
+		qname     string
+		rcode     int
+		answers   []string
+	}{
+		{name: "unknown name", upstreams: []string{startUpstream(t)}, qname: "example.com.", answers: []string{"A 192.0.2.1"}},
+		{name: "container name", upstreams: []string{startUpstream(t)}, qname: "web.", answers: []string{"A 10.0.0.2"}},
+		{name: "inside the zone", upstreams: []string{startUpstream(t)}, qname: "db.docker.", rcode: dns.RcodeNameError},
+		{name: "no upstream", upstreams: []string{unusedUpstream(t)}, qname: "example.com.", rcode: dns.RcodeServerFailure},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			handler := newDNSHandler(registry, Config{
+				Forward:         true,
+				Upstreams:       testCase.upstreams,
+				UpstreamTimeout: testUpstreamTimeout,
+				Zone:            "docker.",
+			})
+
+			msg := query(t, handler, testCase.qname, dns.TypeA)
+			if msg.Rcode != testCase.rcode {
+				t.Fatalf("expected %s, got %s", dns.RcodeToString[testCase.rcode], dns.RcodeToString[msg.Rcode])
+			}
+
+			if got := answers(msg); strings.Join(got, ",") != strings.Join(testCase.answers, ",") {
+				t.Errorf("expected %v, got %v", testCase.answers, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package dnsserver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrInvalidListenAddress = errors.New("invalid listen address")
+
+// ListenAddress is an address the DNS server listens on using the given network ("udp" or "tcp").
+type ListenAddress struct {
+	Net  string
+	Addr string
+}
+
+// DefaultListenAddresses returns the listen addresses used if none are configured: port 53 on all interfaces.
+func DefaultListenAddresses() []ListenAddress {
+	addr := ":" + strconv.Itoa(dnsPort)
+
+	return []ListenAddress{
+		{Net: "udp", Addr: addr},
+		{Net: "tcp", Addr: addr},
+	}
+}
+
+// ParseListenAddress parses an address of the form [udp://|tcp://]host[:port].
+// Without a scheme the address is served on udp and tcp, without a port 53 is used.
+// The host must be an IPv4 or IPv6 address or empty for all interfaces, IPv6 addresses with port are written in brackets.
+func ParseListenAddress(s string) ([]ListenAddress, error) {
+	networks := []string{"udp", "tcp"}
+
+	if scheme, addr, found := strings.Cut(s, "://"); found {
+		if scheme != "udp" && scheme != "tcp" {
+			return nil, fmt.Errorf("%w '%s': unsupported scheme '%s'", ErrInvalidListenAddress, s, scheme)
+		}
+
+		networks = []string{scheme}
+		s = addr
+	}
+
+	addr, err := normalizeListenAddr(s)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make([]ListenAddress, 0, len(networks))
+	for _, network := range networks {
+		addresses = append(addresses, ListenAddress{Net: network, Addr: addr})
+	}
+
+	return addresses, nil
+}
+
+// hostAddresses returns the addresses the server is reachable at on the given listen addresses.
+// If it listens on all interfaces, the addresses of all interfaces except loopback and link-local are returned.
+func hostAddresses(listenAddresses []ListenAddress) []string {
+	var ips []string
+
+	for _, address := range listenAddresses {
+		host, _, err := net.SplitHostPort(address.Addr)
+		if err != nil {
+			continue
+		}
+
+		if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+			return interfaceAddresses()
+		}
+
+		ips = append(ips, host)
+	}
+
+	return distinctAddresses(ips)
+}
+
+func interfaceAddresses() []string {
+	ips, err := getIps()
+	if err != nil {
+		logrus.Warnf("cannot determine the addresses of docker-dns: %v", err)
+
+		return nil
+	}
+
+	var addresses []string
+
+	for _, ip := range ips {
+		if !ip.IsLoopback() && !ip.IsLinkLocalUnicast() {
+			addresses = append(addresses, ip.String())
+		}
+	}
+
+	return distinctAddresses(addresses)
+}
+
+func normalizeListenAddr(s string) (string, error) {
+	host, port, err := net.SplitHostPort(s)
+	if err != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+		port = strconv.Itoa(dnsPort)
+	}
+
+	if host != "" && net.ParseIP(host) == nil {
+		return "", fmt.Errorf("%w '%s': host must be an ip address", ErrInvalidListenAddress, s)
+	}
+
+	if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+		return "", fmt.Errorf("%w '%s': invalid port '%s'", ErrInvalidListenAddress, s, port)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
@@ -0,0 +1,65 @@
+package dnsserver
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseListenAddress(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		input     string
+		addresses []ListenAddress
+	}{
+		{input: "", addresses: []ListenAddress{{Net: "udp", Addr: ":53"}, {Net: "tcp", Addr: ":53"}}},
+		{input: ":5353", addresses: []ListenAddress{{Net: "udp", Addr: ":5353"}, {Net: "tcp", Addr: ":5353"}}},
+		{input: "127.0.0.1", addresses: []ListenAddress{{Net: "udp", Addr: "127.0.0.1:53"}, {Net: "tcp", Addr: "127.0.0.1:53"}}},
+		{input: "udp://172.17.0.1:5353", addresses: []ListenAddress{{Net: "udp", Addr: "172.17.0.1:5353"}}},
+		{input: "tcp://:53", addresses: []ListenAddress{{Net: "tcp", Addr: ":53"}}},
+		{input: "::1", addresses: []ListenAddress{{Net: "udp", Addr: "[::1]:53"}, {Net: "tcp", Addr: "[::1]:53"}}},
+		{input: "[::1]", addresses: []ListenAddress{{Net: "udp", Addr: "[::1]:53"}, {Net: "tcp", Addr: "[::1]:53"}}},
+		{input: "udp://[fd00::1]:5353", addresses: []ListenAddress{{Net: "udp", Addr: "[fd00::1]:5353"}}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.input, func(t *testing.T) {
+			t.Parallel()
+
+			addresses, err := ParseListenAddress(testCase.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(addresses, testCase.addresses) {
+				t.Errorf("expected %v, got %v", testCase.addresses, addresses)
+			}
+		})
+	}
+}
+
+func TestParseListenAddressInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, input := range []string{
+		"http://127.0.0.1:53",
+		"localhost:53",
+		"127.0.0.1:0",
+		"127.0.0.1:65536",
+		"127.0.0.1:dns",
+		"udp://999.0.0.1",
+	} {
+		input := input
+
+		t.Run(input, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := ParseListenAddress(input); !errors.Is(err, ErrInvalidListenAddress) {
+				t.Errorf("expected %v, got %v", ErrInvalidListenAddress, err)
+			}
+		})
+	}
+}
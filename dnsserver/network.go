@@ -3,6 +3,10 @@ package dnsserver
 import (
 	"fmt"
 	"net"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
 )
 
 func getIps() ([]net.IP, error) {
@@ -31,3 +35,112 @@ func getIps() ([]net.IP, error) {
 
 	return ips, nil
 }
+
+// selectAddresses picks the last IPv4 and the last IPv6 address of the given ips.
+func selectAddresses(ips []string) []string {
+	var ipv4, ipv6 string
+
+	for _, ip := range ips {
+		parsed := net.ParseIP(ip)
+
+		switch {
+		case parsed == nil:
+			continue
+		case parsed.To4() != nil:
+			ipv4 = ip
+		default:
+			ipv6 = ip
+		}
+	}
+
+	var selected []string
+
+	if ipv4 != "" {
+		selected = append(selected, ipv4)
+	}
+
+	if ipv6 != "" {
+		selected = append(selected, ipv6)
+	}
+
+	return selected
+}
+
+// normalizeIP returns the canonical string form of the ip, so that differently written IPv6 addresses match.
+func normalizeIP(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		return parsed.String()
+	}
+
+	return ip
+}
+
+// distinctAddresses returns the normalized addresses without duplicates, sorted.
+func distinctAddresses(ips []string) []string {
+	distinct := []string{}
+
+	for _, ip := range ips {
+		if ip = normalizeIP(ip); !containsString(distinct, ip) {
+			distinct = append(distinct, ip)
+		}
+	}
+
+	sort.Strings(distinct)
+
+	return distinct
+}
+
+// reverseNameToIP returns the ip of a reverse lookup name below in-addr.arpa. or ip6.arpa.
+func reverseNameToIP(name string) (net.IP, bool) {
+	const (
+		ipv4Suffix = ".in-addr.arpa."
+		ipv6Suffix = ".ip6.arpa."
+		ipv4Labels = net.IPv4len
+		ipv6Labels = net.IPv6len * 2
+	)
+
+	name = strings.ToLower(dns.Fqdn(name))
+
+	switch {
+	case strings.HasSuffix(name, ipv4Suffix):
+		labels := strings.Split(strings.TrimSuffix(name, ipv4Suffix), ".")
+		if len(labels) != ipv4Labels {
+			return nil, false
+		}
+
+		reverse(labels)
+
+		ip := net.ParseIP(strings.Join(labels, "."))
+
+		return ip, ip != nil
+	case strings.HasSuffix(name, ipv6Suffix):
+		nibbles := strings.Split(strings.TrimSuffix(name, ipv6Suffix), ".")
+		if len(nibbles) != ipv6Labels {
+			return nil, false
+		}
+
+		reverse(nibbles)
+
+		var sb strings.Builder
+
+		for i, nibble := range nibbles {
+			if i > 0 && i%4 == 0 {
+				sb.WriteByte(':')
+			}
+
+			sb.WriteString(nibble)
+		}
+
+		ip := net.ParseIP(sb.String())
+
+		return ip, ip != nil
+	}
+
+	return nil, false
+}
+
+func reverse(s []string) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
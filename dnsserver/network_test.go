@@ -0,0 +1,43 @@
+package dnsserver
+
+import (
+	"testing"
+)
+
+func TestReverseNameToIP(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name string
+		ip   string
+	}{
+		{name: "2.0.17.172.in-addr.arpa.", ip: "172.17.0.2"},
+		{name: "2.0.17.172.IN-ADDR.ARPA", ip: "172.17.0.2"},
+		{name: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa.", ip: "fd00::1"},
+		{name: "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.D.F.IP6.ARPA.", ip: "fd00::1"},
+		{name: "0.17.172.in-addr.arpa."},
+		{name: "1.2.0.17.172.in-addr.arpa."},
+		{name: "x.0.17.172.in-addr.arpa."},
+		{name: "256.0.17.172.in-addr.arpa."},
+		{name: "1.0.0.d.f.ip6.arpa."},
+		{name: "g.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa."},
+		{name: "pong."},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			ip, ok := reverseNameToIP(testCase.name)
+			if ok != (testCase.ip != "") {
+				t.Fatalf("expected ok=%v, got %v", testCase.ip != "", ok)
+			}
+
+			if ok && ip.String() != testCase.ip {
+				t.Errorf("expected %s, got %s", testCase.ip, ip)
+			}
+		})
+	}
+}
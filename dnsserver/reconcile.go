@@ -0,0 +1,104 @@
+package dnsserver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const defaultReconcileInterval = 5 * time.Minute
+
+type (
+	ContainerReconciler interface {
+		Reconcile() (Drift, error)
+	}
+	// ReconcileStatus summarizes the reconciliations run so far.
+	ReconcileStatus struct {
+		Runs      int       `json:"runs"`
+		LastRun   time.Time `json:"lastRun"`
+		LastError string    `json:"lastError,omitempty"`
+		// LastDrift is the drift corrected by the last successful run.
+		LastDrift Drift `json:"lastDrift"`
+		// TotalDrift is the drift corrected by all runs.
+		TotalDrift Drift `json:"totalDrift"`
+	}
+)
+
+// Reconciler periodically reconciles the registry with the running containers, so that missed or mishandled
+// events do not leave stale or missing records behind.
+type Reconciler struct {
+	containerReconciler ContainerReconciler
+	interval            time.Duration
+	lock                *sync.Mutex
+	status              *ReconcileStatus
+}
+
+// NewReconciler creates a new Reconciler.
+func NewReconciler(containerReconciler ContainerReconciler, interval time.Duration) Reconciler {
+	return Reconciler{
+		containerReconciler: containerReconciler,
+		interval:            interval,
+		lock:                &sync.Mutex{},
+		status:              &ReconcileStatus{},
+	}
+}
+
+// Start reconciles every interval until ctx is done.
+func (r Reconciler) Start(ctx context.Context) {
+	logrus.Infof("Reconciling containers every %v", r.interval)
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				logrus.Info("Stopping reconciler")
+
+				return
+			case <-ticker.C:
+				r.reconcile()
+			}
+		}
+	}()
+}
+
+func (r Reconciler) reconcile() {
+	drift, err := r.containerReconciler.Reconcile()
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.status.Runs++
+	r.status.LastRun = time.Now()
+
+	if err != nil {
+		logrus.Errorf("Could not reconcile containers: %v", err)
+
+		r.status.LastError = err.Error()
+
+		return
+	}
+
+	if drift.Total() > 0 {
+		logrus.Warnf("Reconciliation corrected drift: %d added, %d updated, %d removed",
+			drift.Added, drift.Updated, drift.Removed)
+	}
+
+	r.status.LastError = ""
+	r.status.LastDrift = drift
+	r.status.TotalDrift.Added += drift.Added
+	r.status.TotalDrift.Updated += drift.Updated
+	r.status.TotalDrift.Removed += drift.Removed
+}
+
+// ReconcileStatus returns the summary of the reconciliations run so far.
+func (r Reconciler) ReconcileStatus() ReconcileStatus {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return *r.status
+}
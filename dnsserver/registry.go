@@ -2,99 +2,498 @@ package dnsserver
 
 import (
 	"fmt"
+	"net"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
 )
 
+// containerNamesLabel lets a container declare additional DNS names, e.g. docker-dns.names=api.local,api.internal.
+const containerNamesLabel = "docker-dns.names"
+
 type (
 	DNSRegisterer interface {
-		Register(domain string, ip string)
+		ReplaceContainer(containerID string, records ContainerRecords)
 	}
 	DNSUnRegisterer interface {
-		Unregister(domain string)
+		Unregister(containerID string)
+	}
+	// ContainerLister lists the containers that registered names.
+	ContainerLister interface {
+		ContainerIDs() []string
+		ContainerRecords(containerID string) ContainerRecords
 	}
 	DNSRegistrar interface {
 		DNSRegisterer
 		DNSUnRegisterer
+		ContainerLister
+	}
+	ContainerRegisterer interface {
+		RegisterContainer(container types.Container, ips []string, details ContainerDetails)
+		Records(container types.Container, ips []string, details ContainerDetails) ContainerRecords
+		Serves(container types.Container, details ContainerDetails) bool
+	}
+	ContainerRegistrar interface {
+		ContainerRegisterer
+		DNSUnRegisterer
+		ContainerLister
 	}
+	// IPResolver answers lookups. A query gets the aliases once and passes them to LookupIP, so that all its
+	// lookups see the same aliases even if they are reloaded in the meantime.
 	IPResolver interface {
-		LookupIP(string) (string, bool)
+		Aliases() *AliasSnapshot
+		LookupIP(aliases *AliasSnapshot, domain string) ([]string, bool)
+		LookupNames(ip string) ([]string, bool)
 	}
 )
 
 // NewDNSRegistry returns a new instance of DNSRegistry.
 func NewDNSRegistry(aliasProvider AliasProvider) DNSRegistry {
 	return DNSRegistry{
-		ipAddressByContainerName: map[string]string{},
-		lock:                     &sync.Mutex{},
-		aliasProvider:            aliasProvider,
+		ipAddressesByName:         map[string]map[string][]string{},
+		namesByContainerID:        map[string]map[string]struct{}{},
+		reverseNamesByContainerID: map[string][]string{},
+		containerNamesByIPAddress: map[string]map[string]struct{}{},
+		lookupsByName:             map[string]int{},
+		unhealthyContainerIDs:     map[string]struct{}{},
+		lock:                      &sync.Mutex{},
+		aliasProvider:             aliasProvider,
 	}
 }
 
 type (
+	// DNSRegistry holds the addresses of all containers by name.
+	// A name may be registered by multiple containers, e.g. the replicas of a scaled compose service.
 	DNSRegistry struct {
-		ipAddressByContainerName map[string]string
-		lock                     *sync.Mutex
-		aliasProvider            AliasProvider
+		ipAddressesByName         map[string]map[string][]string
+		namesByContainerID        map[string]map[string]struct{}
+		reverseNamesByContainerID map[string][]string
+		containerNamesByIPAddress map[string]map[string]struct{}
+		lookupsByName             map[string]int
+		unhealthyContainerIDs     map[string]struct{}
+		lock                      *sync.Mutex
+		aliasProvider             AliasProvider
 	}
 	AliasProvider interface {
-		GetAliasForDomain(string) (string, bool)
+		Snapshot() *AliasSnapshot
 	}
 )
 
-func (r DNSRegistry) LookupIP(domain string) (string, bool) {
+// Aliases returns the aliases currently in use.
+func (r DNSRegistry) Aliases() *AliasSnapshot {
+	return r.aliasProvider.Snapshot()
+}
+
+// LookupIP returns the IPv4 and IPv6 addresses of all containers registered for the given domain,
+// or for the target of the alias defined for the domain by aliases.
+// Containers which are not healthy are left out, unless none of the containers is healthy, which is decided
+// for IPv4 and IPv6 addresses separately. The order of the addresses is rotated with every lookup to distribute
+// clients across the containers.
+func (r DNSRegistry) LookupIP(aliases *AliasSnapshot, domain string) ([]string, bool) {
+	if alias, ok := aliases.GetAliasForDomain(domain); ok {
+		if ips, ok := aliasTargetIPs(alias); ok {
+			return ips, true
+		}
+
+		domain = alias
+	}
+
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
-	if alias, ok := r.aliasProvider.GetAliasForDomain(domain); ok {
-		domain = alias
+	ipsByContainerID, ok := r.ipAddressesByName[domain]
+	if !ok {
+		return nil, false
+	}
+
+	containerIDs := make([]string, 0, len(ipsByContainerID))
+	for containerID := range ipsByContainerID {
+		containerIDs = append(containerIDs, containerID)
+	}
+
+	sort.Strings(containerIDs)
+
+	var ipv4, ipv6 addressPool
+
+	for _, containerID := range containerIDs {
+		_, unhealthy := r.unhealthyContainerIDs[containerID]
+
+		for _, ip := range ipsByContainerID[containerID] {
+			if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() != nil {
+				ipv4.add(ip, !unhealthy)
+			} else {
+				ipv6.add(ip, !unhealthy)
+			}
+		}
+	}
+
+	lookups := r.lookupsByName[domain]
+	r.lookupsByName[domain]++
+
+	return append(ipv4.addresses(lookups), ipv6.addresses(lookups)...), true
+}
+
+// addressPool collects the addresses of one address family registered for a name.
+type addressPool struct {
+	all     []string
+	healthy []string
+}
+
+func (p *addressPool) add(ip string, healthy bool) {
+	p.all = append(p.all, ip)
+
+	if healthy {
+		p.healthy = append(p.healthy, ip)
+	}
+}
+
+// addresses returns the healthy addresses, or all addresses if none is healthy, rotated by the number of lookups.
+func (p addressPool) addresses(lookups int) []string {
+	ips := p.healthy
+	if len(ips) == 0 {
+		ips = p.all
+	}
+
+	if len(ips) == 0 {
+		return nil
+	}
+
+	offset := lookups % len(ips)
+
+	return append(ips[offset:], ips[:offset]...)
+}
+
+// LookupNames returns the container names registered for the given ip, used to answer reverse lookups.
+// Names declared by labels and network aliases are not returned.
+func (r DNSRegistry) LookupNames(ip string) ([]string, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	names, ok := r.containerNamesByIPAddress[normalizeIP(ip)]
+	if !ok {
+		return nil, false
+	}
+
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+
+	sort.Strings(sortedNames)
+
+	return sortedNames, true
+}
+
+// Unregister removes all names and addresses registered by the given container.
+func (r DNSRegistry) Unregister(containerID string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.removeContainer(containerID)
+}
+
+// ReplaceContainer replaces all names and addresses registered by the given container at once,
+// so that lookups never see the container partially registered.
+// Addresses of containers which are not healthy are only returned if no healthy container shares the name.
+func (r DNSRegistry) ReplaceContainer(containerID string, records ContainerRecords) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.removeContainer(containerID)
+
+	for name, ips := range records.IPsByName {
+		r.addRecord(containerID, name, ips)
+	}
+
+	for _, name := range records.ReverseNames {
+		r.addReverseRecord(containerID, name)
+	}
+
+	if !records.Healthy {
+		r.unhealthyContainerIDs[containerID] = struct{}{}
 	}
+}
 
-	if ip, ok := r.ipAddressByContainerName[domain]; ok {
-		return ip, ok
+func (r DNSRegistry) removeContainer(containerID string) {
+	for _, name := range r.reverseNamesByContainerID[containerID] {
+		r.removeReverseRecord(containerID, name)
 	}
 
-	return "", false
+	for name := range r.namesByContainerID[containerID] {
+		r.removeRecord(containerID, name)
+	}
+
+	delete(r.namesByContainerID, containerID)
+	delete(r.reverseNamesByContainerID, containerID)
+	delete(r.unhealthyContainerIDs, containerID)
 }
 
-func (r DNSRegistry) Unregister(containerName string) {
+// ContainerIDs returns the ids of all containers that registered names, sorted.
+func (r DNSRegistry) ContainerIDs() []string {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
-	delete(r.ipAddressByContainerName, containerName)
+	containerIDs := make([]string, 0, len(r.namesByContainerID))
+	for containerID := range r.namesByContainerID {
+		containerIDs = append(containerIDs, containerID)
+	}
+
+	sort.Strings(containerIDs)
+
+	return containerIDs
 }
 
-func (r DNSRegistry) Register(containerName string, ip string) {
+// ContainerRecords returns the names registered by the given container with their addresses and whether
+// the container is healthy.
+func (r DNSRegistry) ContainerRecords(containerID string) ContainerRecords {
 	r.lock.Lock()
 	defer r.lock.Unlock()
 
-	r.ipAddressByContainerName[containerName] = ip
+	_, unhealthy := r.unhealthyContainerIDs[containerID]
+	records := ContainerRecords{
+		IPsByName:    map[string][]string{},
+		ReverseNames: append([]string{}, r.reverseNamesByContainerID[containerID]...),
+		Healthy:      !unhealthy,
+	}
+
+	for name := range r.namesByContainerID[containerID] {
+		records.IPsByName[name] = append([]string{}, r.ipAddressesByName[name][containerID]...)
+	}
+
+	return records
+}
+
+func (r DNSRegistry) addRecord(containerID string, name string, ips []string) {
+	if _, ok := r.ipAddressesByName[name]; !ok {
+		r.ipAddressesByName[name] = map[string][]string{}
+	}
+
+	if _, ok := r.namesByContainerID[containerID]; !ok {
+		r.namesByContainerID[containerID] = map[string]struct{}{}
+	}
+
+	r.ipAddressesByName[name][containerID] = ips
+	r.namesByContainerID[containerID][name] = struct{}{}
+}
+
+// addReverseRecord lets reverse lookups of the addresses registered for the name by the container return the name.
+func (r DNSRegistry) addReverseRecord(containerID string, name string) {
+	r.reverseNamesByContainerID[containerID] = append(r.reverseNamesByContainerID[containerID], name)
+
+	for _, ip := range r.ipAddressesByName[name][containerID] {
+		ip = normalizeIP(ip)
+		if _, ok := r.containerNamesByIPAddress[ip]; !ok {
+			r.containerNamesByIPAddress[ip] = map[string]struct{}{}
+		}
+
+		r.containerNamesByIPAddress[ip][name] = struct{}{}
+	}
+}
+
+// removeReverseRecord must be called before the record of the name is removed.
+func (r DNSRegistry) removeReverseRecord(containerID string, name string) {
+	for _, ip := range r.ipAddressesByName[name][containerID] {
+		ip = normalizeIP(ip)
+
+		delete(r.containerNamesByIPAddress[ip], name)
+
+		if len(r.containerNamesByIPAddress[ip]) == 0 {
+			delete(r.containerNamesByIPAddress, ip)
+		}
+	}
+}
+
+func (r DNSRegistry) removeRecord(containerID string, name string) {
+	delete(r.ipAddressesByName[name], containerID)
+
+	if len(r.ipAddressesByName[name]) == 0 {
+		delete(r.ipAddressesByName, name)
+		delete(r.lookupsByName, name)
+	}
 }
 
 // NewContainerRegistry creates a new instance of ContainerDNSRegistry.
-func NewContainerRegistry(registerer DNSRegistrar) ContainerDNSRegistry {
+func NewContainerRegistry(registerer DNSRegistrar, policy ContainerPolicy) ContainerDNSRegistry {
 	return ContainerDNSRegistry{
 		registry: registerer,
+		policy:   policy,
+	}
+}
+
+type (
+	// ContainerRecords are the names of a container, each with the addresses it resolves to, and whether
+	// the container is healthy.
+	ContainerRecords struct {
+		IPsByName map[string][]string
+		// ReverseNames are the names of IPsByName reverse lookups of their addresses are answered with.
+		ReverseNames []string
+		Healthy      bool
+	}
+	ContainerDNSRegistry struct {
+		registry DNSRegistrar
+		policy   ContainerPolicy
+	}
+	// ContainerPolicy decides which running containers are served. Records of withdrawn containers are removed
+	// until they are served again.
+	ContainerPolicy struct {
+		// WithdrawPaused withdraws the records of paused containers.
+		WithdrawPaused bool
+		// WithdrawUnhealthy withdraws the records of containers whose healthcheck reports unhealthy.
+		WithdrawUnhealthy bool
+	}
+)
+
+// Serves reports whether the container is served according to the policy, judged by its state and health.
+func (p ContainerPolicy) Serves(container types.Container, details ContainerDetails) bool {
+	switch {
+	case p.WithdrawPaused && container.State == "paused":
+		return false
+	case p.WithdrawUnhealthy && details.Health != nil && details.Health.Status == types.Unhealthy:
+		return false
+	default:
+		return true
+	}
+}
+
+func (r ContainerDNSRegistry) Serves(container types.Container, details ContainerDetails) bool {
+	return r.policy.Serves(container, details)
+}
+
+func (r ContainerDNSRegistry) Unregister(containerID string) {
+	r.registry.Unregister(containerID)
+}
+
+func (r ContainerDNSRegistry) ContainerIDs() []string {
+	return r.registry.ContainerIDs()
+}
+
+func (r ContainerDNSRegistry) ContainerRecords(containerID string) ContainerRecords {
+	return r.registry.ContainerRecords(containerID)
+}
+
+// RegisterContainer registers the container's names, the names declared by its docker-dns.names label
+// and its network aliases. Network aliases resolve to the addresses of the networks they are defined in.
+// Names the container registered before but does not have anymore are removed, e.g. after a rename.
+// Containers the policy withdraws are unregistered instead.
+func (r ContainerDNSRegistry) RegisterContainer(container types.Container, ips []string, details ContainerDetails) {
+	if !r.policy.Serves(container, details) {
+		logrus.Infof("withdrawing container %s, it is %s", containerName(container), container.Status)
+
+		r.registry.Unregister(container.ID)
+
+		return
 	}
+
+	r.registry.ReplaceContainer(container.ID, r.Records(container, ips, details))
 }
 
-type ContainerDNSRegistry struct {
-	registry DNSRegistrar
+// Records returns the records the container registers: its names and the names declared by its docker-dns.names
+// label resolving to the given addresses and its network aliases resolving to the addresses of their networks.
+func (r ContainerDNSRegistry) Records(container types.Container, ips []string, details ContainerDetails) ContainerRecords {
+	ipsByName := map[string][]string{}
+	reverseNames := make([]string, 0, len(container.Names))
+
+	for _, containerName := range container.Names {
+		name := normalizeContainerName(containerName)
+		ipsByName[name] = ips
+		reverseNames = append(reverseNames, name)
+	}
+
+	for _, name := range labelNames(container) {
+		ipsByName[name] = ips
+	}
+
+	for _, alias := range details.NetworkAliases {
+		if _, registered := ipsByName[alias.Name]; registered || len(alias.IPs) == 0 {
+			continue
+		}
+
+		ipsByName[alias.Name] = alias.IPs
+	}
+
+	return ContainerRecords{IPsByName: ipsByName, ReverseNames: reverseNames, Healthy: isHealthy(details.Health)}
+}
+
+// differences describes how the records differ from the other records, e.g. "web.: [10.0.0.2] instead of [10.0.0.3]".
+// Addresses are compared regardless of their order.
+func (c ContainerRecords) differences(other ContainerRecords) []string {
+	var differences []string
+
+	for _, name := range sortedKeys(c.IPsByName) {
+		ips := distinctAddresses(c.IPsByName[name])
+
+		otherIPs, ok := other.IPsByName[name]
+		switch {
+		case !ok:
+			differences = append(differences, fmt.Sprintf("%s: not a name anymore", name))
+		case !slices.Equal(ips, distinctAddresses(otherIPs)):
+			differences = append(differences, fmt.Sprintf("%s: %v instead of %v", name, ips, distinctAddresses(otherIPs)))
+		}
+	}
+
+	for _, name := range sortedKeys(other.IPsByName) {
+		if _, ok := c.IPsByName[name]; !ok {
+			differences = append(differences, fmt.Sprintf("%s: missing", name))
+		}
+	}
+
+	if c.Healthy != other.Healthy {
+		differences = append(differences, fmt.Sprintf("healthy: %v instead of %v", c.Healthy, other.Healthy))
+	}
+
+	return differences
 }
 
-func (r ContainerDNSRegistry) Unregister(containerName string) {
-	dnsContainerName := r.normalizeContainerName(containerName)
+func sortedKeys(ipsByName map[string][]string) []string {
+	keys := make([]string, 0, len(ipsByName))
+	for key := range ipsByName {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
 
-	r.registry.Unregister(dnsContainerName)
+// isHealthy reports whether the healthcheck of the container reports healthy or the container has no healthcheck.
+func isHealthy(health *types.Health) bool {
+	return health == nil || health.Status == types.Healthy || health.Status == types.NoHealthcheck
 }
 
-func (r ContainerDNSRegistry) Register(containerName string, ip string) {
-	dnsContainerName := r.normalizeContainerName(containerName)
+// labelNames returns the fully qualified names declared by the container's docker-dns.names label.
+func labelNames(container types.Container) []string {
+	label, ok := container.Labels[containerNamesLabel]
+	if !ok {
+		return nil
+	}
+
+	var names []string
+
+	for _, name := range strings.Split(label, ",") {
+		name = dns.Fqdn(strings.TrimSpace(name))
+		if name == "." {
+			continue
+		}
+
+		if _, ok := dns.IsDomainName(name); !ok {
+			logrus.Warnf("ignoring invalid name '%s' in label %s of container %s", name, containerNamesLabel, container.ID)
+
+			continue
+		}
+
+		names = append(names, name)
+	}
 
-	r.registry.Register(dnsContainerName, ip)
+	return names
 }
 
-func (r ContainerDNSRegistry) normalizeContainerName(containerName string) string {
+// normalizeContainerName turns a docker container name into a DNS name, e.g. /project_web_1 becomes web.
+func normalizeContainerName(containerName string) string {
 	var dnsContainerName string
 
 	parts := strings.Split(containerName, "_")
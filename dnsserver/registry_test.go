@@ -0,0 +1,108 @@
+package dnsserver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestDNSRegistryLookupNames(t *testing.T) {
+	t.Parallel()
+
+	registry := NewDNSRegistry(nil)
+	containers := NewContainerRegistry(registry, ContainerPolicy{})
+
+	container := types.Container{
+		ID:     "a",
+		Names:  []string{"/project_web_1"},
+		Labels: map[string]string{containerNamesLabel: "api.local"},
+	}
+	details := ContainerDetails{NetworkAliases: []NetworkAlias{{Name: "www.", IPs: []string{"10.0.0.2"}}}}
+
+	containers.RegisterContainer(container, []string{"10.0.0.2"}, details)
+
+	names, ok := registry.LookupNames("10.0.0.2")
+	if !ok || !reflect.DeepEqual(names, []string{"web."}) {
+		t.Errorf("expected only the container name, got %v %v", names, ok)
+	}
+
+	container.Names = []string{"/project_app_1"}
+	containers.RegisterContainer(container, []string{"10.0.0.2"}, details)
+
+	if names, _ = registry.LookupNames("10.0.0.2"); !reflect.DeepEqual(names, []string{"app."}) {
+		t.Errorf("expected the new container name after a rename, got %v", names)
+	}
+
+	registry.Unregister("a")
+
+	if names, ok = registry.LookupNames("10.0.0.2"); ok {
+		t.Errorf("expected no names after unregistering, got %v", names)
+	}
+}
+
+func TestDNSRegistryLookupIPHealth(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name    string
+		healthy map[string]bool
+		ips     []string
+	}{
+		{name: "all healthy", healthy: map[string]bool{"a": true, "b": true}, ips: []string{"10.0.0.2", "10.0.0.3", "fd00::2"}},
+		{name: "one unhealthy", healthy: map[string]bool{"a": true, "b": false}, ips: []string{"10.0.0.2", "fd00::2"}},
+		{name: "only IPv6 unhealthy", healthy: map[string]bool{"a": false, "b": true}, ips: []string{"10.0.0.3", "fd00::2"}},
+		{name: "all unhealthy", healthy: map[string]bool{"a": false, "b": false}, ips: []string{"10.0.0.2", "10.0.0.3", "fd00::2"}},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			registry := NewDNSRegistry(nil)
+			registry.ReplaceContainer("a", ContainerRecords{
+				IPsByName: map[string][]string{"web.": {"10.0.0.2", "fd00::2"}},
+				Healthy:   testCase.healthy["a"],
+			})
+			registry.ReplaceContainer("b", ContainerRecords{
+				IPsByName: map[string][]string{"web.": {"10.0.0.3"}},
+				Healthy:   testCase.healthy["b"],
+			})
+
+			ips, ok := registry.LookupIP(newAliasSnapshot(newAliasSet(), 1, 0), "web.")
+			if !ok || !reflect.DeepEqual(ips, testCase.ips) {
+				t.Errorf("expected %v, got %v %v", testCase.ips, ips, ok)
+			}
+		})
+	}
+}
+
+func TestDNSRegistryLookupIPRotation(t *testing.T) {
+	t.Parallel()
+
+	registry := NewDNSRegistry(nil)
+	aliases := newAliasSnapshot(newAliasSet(), 1, 0)
+
+	for containerID, ip := range map[string]string{"a": "10.0.0.2", "b": "10.0.0.3", "c": "10.0.0.4"} {
+		registry.ReplaceContainer(containerID, ContainerRecords{IPsByName: map[string][]string{"web.": {ip}}, Healthy: true})
+	}
+
+	for _, expected := range [][]string{
+		{"10.0.0.2", "10.0.0.3", "10.0.0.4"},
+		{"10.0.0.3", "10.0.0.4", "10.0.0.2"},
+		{"10.0.0.4", "10.0.0.2", "10.0.0.3"},
+		{"10.0.0.2", "10.0.0.3", "10.0.0.4"},
+	} {
+		if ips, _ := registry.LookupIP(aliases, "web."); !reflect.DeepEqual(ips, expected) {
+			t.Errorf("expected %v, got %v", expected, ips)
+		}
+	}
+
+	registry.Unregister("b")
+
+	if ips, _ := registry.LookupIP(aliases, "web."); len(ips) != 2 {
+		t.Errorf("expected the addresses of the remaining replicas, got %v", ips)
+	}
+}
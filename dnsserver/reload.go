@@ -0,0 +1,100 @@
+package dnsserver
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type (
+	AliasReloader interface {
+		Reload() AliasLoadResult
+	}
+	ContainerResyncer interface {
+		Resync() error
+	}
+	// ReloadResult is the outcome of a reload triggered by SIGHUP or the status endpoint.
+	ReloadResult struct {
+		Time time.Time `json:"time"`
+		// Aliases is the number of aliases in use after the reload.
+		Aliases int `json:"aliases"`
+		// Applied is false if the alias files were invalid and the previous aliases are kept.
+		Applied bool `json:"applied"`
+		// AliasVersion is the version of the aliases in use after the reload.
+		AliasVersion uint64 `json:"aliasVersion"`
+		// Resynced is true if the containers were resynced with docker.
+		Resynced bool     `json:"resynced"`
+		Errors   []string `json:"errors,omitempty"`
+		Warnings []string `json:"warnings,omitempty"`
+	}
+)
+
+// Reloader reloads the aliases on demand and, if a ContainerResyncer is given, resyncs the containers with docker.
+type Reloader struct {
+	aliasReloader AliasReloader
+	resyncer      ContainerResyncer
+	lock          *sync.Mutex
+	last          *ReloadResult
+}
+
+// NewReloader creates a new Reloader, resyncer may be nil to reload the aliases only.
+func NewReloader(aliasReloader AliasReloader, resyncer ContainerResyncer) Reloader {
+	return Reloader{
+		aliasReloader: aliasReloader,
+		resyncer:      resyncer,
+		lock:          &sync.Mutex{},
+		last:          &ReloadResult{},
+	}
+}
+
+// Reload reloads the aliases and resyncs the containers. Concurrent reloads are run one after the other.
+func (r Reloader) Reload() ReloadResult {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	loaded := r.aliasReloader.Reload()
+	result := ReloadResult{
+		Time:         time.Now(),
+		Aliases:      loaded.Aliases,
+		Applied:      loaded.Applied,
+		AliasVersion: loaded.Version,
+		Errors:       errorStrings(loaded.Errors),
+		Warnings:     errorStrings(loaded.Warnings),
+	}
+
+	if r.resyncer != nil {
+		if err := r.resyncer.Resync(); err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		} else {
+			result.Resynced = true
+		}
+	}
+
+	if len(result.Errors) > 0 {
+		logrus.Errorf("Reload finished with %d errors, %d aliases in use", len(result.Errors), result.Aliases)
+	} else {
+		logrus.Infof("Reload finished, %d aliases in use", result.Aliases)
+	}
+
+	*r.last = result
+
+	return result
+}
+
+// LastReload returns the result of the last reload, which has a zero Time if there was none.
+func (r Reloader) LastReload() ReloadResult {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return *r.last
+}
+
+func errorStrings(errs []error) []string {
+	var messages []string
+	for _, err := range errs {
+		messages = append(messages, err.Error())
+	}
+
+	return messages
+}
@@ -4,7 +4,6 @@ import (
 	"context"
 	"net"
 	"os"
-	"strconv"
 
 	"github.com/sirupsen/logrus"
 
@@ -12,71 +11,372 @@ import (
 )
 
 const dnsPort = 53
+const recordTTL = 60
 
 type DNSHandler struct {
 	ipResolver IPResolver
+	forwarder  QueryForwarder
+	zone       *zone
+	aliasCNAME bool
 }
 
-func newDNSHandler(ipResolver IPResolver) DNSHandler {
-	return DNSHandler{
+func newDNSHandler(ipResolver IPResolver, config Config) DNSHandler {
+	h := DNSHandler{
 		ipResolver: ipResolver,
+		zone:       newZone(config.Zone, config.NegativeTTL, config.listenAddresses()),
+		aliasCNAME: config.AliasCNAME,
 	}
+
+	if config.Forward {
+		h.forwarder = NewForwarder(config)
+	}
+
+	return h
 }
 
 // ServeDNS handles a dns request.
 func (h DNSHandler) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
-	msg := dns.Msg{}
+	msg := h.answer(r)
+
+	if opt := r.IsEdns0(); opt != nil && msg.IsEdns0() == nil {
+		msg.SetEdns0(opt.UDPSize(), opt.Do())
+	}
+
+	if _, isUDP := w.RemoteAddr().(*net.UDPAddr); isUDP {
+		msg.Truncate(udpBufferSize(r))
+	}
+
+	if err := w.WriteMsg(msg); err != nil {
+		logrus.Errorf("Error writing DNS response: %v", err)
+	}
+}
+
+// udpBufferSize returns the maximum response size the client accepts over UDP.
+func udpBufferSize(r *dns.Msg) int {
+	if opt := r.IsEdns0(); opt != nil {
+		return int(opt.UDPSize())
+	}
+
+	return dns.MinMsgSize
+}
+
+func (h DNSHandler) answer(r *dns.Msg) *dns.Msg {
+	question := r.Question[0]
+	aliases := h.ipResolver.Aliases()
+
+	alias, isAlias := aliases.GetAlias(question.Name)
+	if isAlias && h.answersWithCNAME(alias) {
+		return h.answerAlias(r, aliases, alias)
+	}
+
+	addresses, local := h.lookupIP(aliases, question.Name)
+	if isAlias && !local && h.isExternalName(alias.Target) {
+		return h.answerExternalAlias(r, alias)
+	}
+
+	// an alias of a container which is not running is answered with no data rather than forwarded
+	names, isReverse := h.lookupNames(question.Name)
+	local = local || isReverse || isAlias
+
+	if h.forwards(question.Name, local) {
+		return h.forward(r)
+	}
+
+	return h.answerLocal(r, local, addresses, alias.ttl(), names)
+}
+
+// forwards reports whether a query for the name is forwarded to the upstream resolvers.
+// Names known to docker-dns and names inside the zone are never forwarded.
+func (h DNSHandler) forwards(name string, local bool) bool {
+	return !local && h.forwarder != nil && !h.zone.contains(name)
+}
+
+// answerLocal answers the query with the given addresses or reverse lookup names as the authority for them.
+func (h DNSHandler) answerLocal(r *dns.Msg, local bool, addresses []string, ttl uint32, names []string) *dns.Msg {
+	question := r.Question[0]
+
+	msg := &dns.Msg{}
 	msg.SetReply(r)
+	msg.Authoritative = true
+
+	switch {
+	case h.zone.isApex(question.Name):
+		h.answerApex(msg)
+	case !local:
+		h.answerUnknown(msg)
+	case question.Qtype == dns.TypeA, question.Qtype == dns.TypeAAAA:
+		h.answerAddress(msg, addresses, ttl)
+	case question.Qtype == dns.TypePTR:
+		h.answerPTR(msg, names)
+	}
+
+	if len(msg.Answer) == 0 && h.zone.contains(question.Name) {
+		msg.Ns = append(msg.Ns, h.zone.soa())
+	}
+
+	return msg
+}
+
+// answersWithCNAME reports whether the alias is answered with a CNAME, which is decided by the type of the alias
+// or, if it has none, by the alias-cname option. Aliases for static addresses are always answered with addresses.
+func (h DNSHandler) answersWithCNAME(alias Alias) bool {
+	switch {
+	case alias.isStatic():
+		return false
+	case alias.Type == AliasTypeCNAME:
+		return true
+	case alias.Type == AliasTypeAddress:
+		return false
+	default:
+		return h.aliasCNAME
+	}
+}
+
+// isExternalName reports whether the name may be resolved by the upstream resolvers if docker-dns does not know it.
+// Single label names are container names and names inside the zone are managed by docker-dns, both are answered
+// locally even if no container is registered for them right now.
+func (h DNSHandler) isExternalName(name string) bool {
+	return dns.CountLabel(name) > 1 && !h.zone.contains(name)
+}
+
+// lookupIP looks up the domain as it is and, for names inside the zone, relative to the zone origin.
+// The nameserver of the zone resolves to the addresses of docker-dns.
+func (h DNSHandler) lookupIP(aliases *AliasSnapshot, domain string) ([]string, bool) {
+	if h.zone.isNameserver(domain) {
+		return h.zone.nameserverIPs, true
+	}
+
+	if addresses, ok := h.ipResolver.LookupIP(aliases, domain); ok {
+		return addresses, true
+	}
+
+	if name, ok := h.zone.relativeName(domain); ok {
+		return h.ipResolver.LookupIP(aliases, name)
+	}
+
+	return nil, false
+}
+
+// lookupNames returns the registered names for a reverse lookup name like 2.0.17.172.in-addr.arpa.
+func (h DNSHandler) lookupNames(domain string) ([]string, bool) {
+	ip, ok := reverseNameToIP(domain)
+	if !ok {
+		return nil, false
+	}
+
+	return h.ipResolver.LookupNames(ip.String())
+}
+
+func (h DNSHandler) forward(r *dns.Msg) *dns.Msg {
+	resp, err := h.forwarder.Forward(r)
+	if err != nil {
+		logrus.Errorf("Error forwarding DNS request: %v", err)
 
-	if r.Question[0].Qtype == dns.TypeA {
-		msg.Authoritative = true
-		domain := msg.Question[0].Name
+		msg := &dns.Msg{}
+		msg.SetRcode(r, dns.RcodeServerFailure)
+		msg.RecursionAvailable = true
 
-		address, ok := h.ipResolver.LookupIP(domain)
-		if ok {
-			logrus.Debugf("address found for %s", domain)
+		return msg
+	}
+
+	resp.Id = r.Id
+
+	return resp
+}
+
+// answerAlias answers with a CNAME to the target and, for address queries, the addresses of the target.
+// All records are answered with the TTL of the alias.
+// External targets unknown to docker-dns are resolved by the upstream resolvers if forwarding is enabled.
+func (h DNSHandler) answerAlias(r *dns.Msg, aliases *AliasSnapshot, alias Alias) *dns.Msg {
+	target := alias.Target
+	msg := newCNAMEReply(r, target, alias.ttl())
+	question := r.Question[0]
+
+	if question.Qtype != dns.TypeA && question.Qtype != dns.TypeAAAA {
+		return msg
+	}
 
-			const ttl = 60
+	addresses, ok := h.lookupIP(aliases, target)
+	if !ok {
+		logrus.Debugf("alias target %s of %s not found locally", target, question.Name)
 
-			msg.Answer = append(msg.Answer, &dns.A{
-				Hdr: dns.RR_Header{Name: domain, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
-				A:   net.ParseIP(address),
-			})
-		} else {
-			logrus.Debugf("address not found for %s", domain)
+		if h.isExternalName(target) {
+			msg.Answer = append(msg.Answer, h.resolveUpstream(target, question.Qtype)...)
 		}
+
+		return msg
 	}
 
-	if err := w.WriteMsg(&msg); err != nil {
-		logrus.Errorf("Error writing DNS response: %v", err)
+	for _, address := range addresses {
+		if rr := newAddressRecord(target, question.Qtype, address, alias.ttl()); rr != nil {
+			msg.Answer = append(msg.Answer, rr)
+		}
+	}
+
+	return msg
+}
+
+// answerExternalAlias answers queries for an alias of a name unknown to docker-dns with the records
+// the upstream resolvers return for the target. Without such records, the alias is answered with a CNAME.
+func (h DNSHandler) answerExternalAlias(r *dns.Msg, alias Alias) *dns.Msg {
+	question := r.Question[0]
+	upstreamAnswer := h.resolveUpstream(alias.Target, question.Qtype)
+
+	var records []dns.RR
+
+	for _, rr := range upstreamAnswer {
+		if rr.Header().Rrtype != question.Qtype {
+			continue
+		}
+
+		record := dns.Copy(rr)
+		record.Header().Name = question.Name
+		records = append(records, record)
+	}
+
+	if len(records) == 0 {
+		msg := newCNAMEReply(r, alias.Target, alias.ttl())
+		msg.Answer = append(msg.Answer, upstreamAnswer...)
+
+		return msg
+	}
+
+	msg := &dns.Msg{}
+	msg.SetReply(r)
+	msg.Answer = records
+
+	return msg
+}
+
+// resolveUpstream returns the answer of the upstream resolvers for the name, or nil if forwarding is disabled.
+func (h DNSHandler) resolveUpstream(name string, qtype uint16) []dns.RR {
+	if h.forwarder == nil {
+		return nil
 	}
+
+	query := &dns.Msg{}
+	query.SetQuestion(name, qtype)
+
+	resp, err := h.forwarder.Forward(query)
+	if err != nil {
+		logrus.Errorf("Error resolving %s upstream: %v", name, err)
+
+		return nil
+	}
+
+	return resp.Answer
+}
+
+func newCNAMEReply(r *dns.Msg, target string, ttl uint32) *dns.Msg {
+	msg := &dns.Msg{}
+	msg.SetReply(r)
+	msg.Authoritative = true
+
+	msg.Answer = append(msg.Answer, &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: ttl},
+		Target: target,
+	})
+
+	return msg
+}
+
+func (h DNSHandler) answerApex(msg *dns.Msg) {
+	switch msg.Question[0].Qtype {
+	case dns.TypeSOA:
+		msg.Answer = append(msg.Answer, h.zone.soa())
+	case dns.TypeNS:
+		msg.Answer = append(msg.Answer, h.zone.ns())
+	}
+}
+
+func (h DNSHandler) answerUnknown(msg *dns.Msg) {
+	domain := msg.Question[0].Name
+
+	logrus.Debugf("address not found for %s", domain)
+
+	if h.zone.contains(domain) {
+		msg.Rcode = dns.RcodeNameError
+	}
+}
+
+func (h DNSHandler) answerAddress(msg *dns.Msg, addresses []string, ttl uint32) {
+	domain := msg.Question[0].Name
+	qtype := msg.Question[0].Qtype
+
+	logrus.Debugf("address found for %s", domain)
+
+	for _, address := range addresses {
+		if rr := newAddressRecord(domain, qtype, address, ttl); rr != nil {
+			msg.Answer = append(msg.Answer, rr)
+		}
+	}
+
+	if len(msg.Answer) == 0 {
+		logrus.Debugf("no %s record for %s", dns.TypeToString[qtype], domain)
+	}
+}
+
+// answerPTR answers with the names of the containers, inside the zone if one is configured.
+func (h DNSHandler) answerPTR(msg *dns.Msg, names []string) {
+	domain := msg.Question[0].Name
+
+	for _, name := range names {
+		msg.Answer = append(msg.Answer, &dns.PTR{
+			Hdr: dns.RR_Header{Name: domain, Rrtype: dns.TypePTR, Class: dns.ClassINET, Ttl: recordTTL},
+			Ptr: h.zone.absoluteName(name),
+		})
+	}
+}
+
+// newAddressRecord returns an A or AAAA record for the given address, or nil if the address does not match qtype.
+func newAddressRecord(domain string, qtype uint16, address string, ttl uint32) dns.RR {
+	ip := net.ParseIP(address)
+	hdr := dns.RR_Header{Name: domain, Rrtype: qtype, Class: dns.ClassINET, Ttl: ttl}
+
+	switch {
+	case ip == nil:
+		return nil
+	case qtype == dns.TypeA && ip.To4() != nil:
+		return &dns.A{Hdr: hdr, A: ip.To4()}
+	case qtype == dns.TypeAAAA && ip.To4() == nil:
+		return &dns.AAAA{Hdr: hdr, AAAA: ip}
+	}
+
+	return nil
 }
 
 // Run starts the DNS server which will answer requests using the given IPResolver.
-func Run(ctx context.Context, ipResolver IPResolver) {
-	s := spawnServer(ipResolver)
+func Run(ctx context.Context, ipResolver IPResolver, config Config) {
+	handler := newDNSHandler(ipResolver, config)
+
+	servers := make([]*dns.Server, 0, len(config.listenAddresses()))
+	for _, address := range config.listenAddresses() {
+		servers = append(servers, spawnServer(handler, address))
+	}
 
 	<-ctx.Done()
 
-	stopServer(s)
+	stopServers(servers)
 }
 
-func stopServer(s *dns.Server) {
-	if err := s.Shutdown(); err != nil {
-		logrus.Errorf("Failed to gracefully shutdown udp listener %s\n", err.Error())
-		os.Exit(1)
+func stopServers(servers []*dns.Server) {
+	for _, s := range servers {
+		if err := s.Shutdown(); err != nil {
+			logrus.Errorf("Failed to gracefully shutdown %s listener on %s %s\n", s.Net, s.Addr, err.Error())
+			os.Exit(1)
+		}
 	}
 }
 
-func spawnServer(ipResolver IPResolver) *dns.Server {
-	logrus.Infof("starting dns server (udp) on :%v\n", dnsPort)
+func spawnServer(handler dns.Handler, address ListenAddress) *dns.Server {
+	logrus.Infof("starting dns server (%s) on %s\n", address.Net, address.Addr)
 
-	srv := &dns.Server{Addr: ":" + strconv.Itoa(dnsPort), Net: "udp"}
-	srv.Handler = newDNSHandler(ipResolver)
+	srv := &dns.Server{Addr: address.Addr, Net: address.Net}
+	srv.Handler = handler
 
 	go func() {
 		if err := srv.ListenAndServe(); err != nil {
-			logrus.Errorf("Failed to set udp listener %s\n", err.Error())
+			logrus.Errorf("Failed to set %s listener on %s %s\n", address.Net, address.Addr, err.Error())
 			os.Exit(1)
 		}
 	}()
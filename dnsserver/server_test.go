@@ -0,0 +1,351 @@
+package dnsserver
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+type recordingResponseWriter struct {
+	msg *dns.Msg
+}
+
+func (w *recordingResponseWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: dnsPort}
+}
+
+func (w *recordingResponseWriter) RemoteAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 10053}
+}
+
+func (w *recordingResponseWriter) WriteMsg(msg *dns.Msg) error {
+	w.msg = msg
+
+	return nil
+}
+
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *recordingResponseWriter) Close() error        { return nil }
+func (w *recordingResponseWriter) TsigStatus() error   { return nil }
+func (w *recordingResponseWriter) TsigTimersOnly(bool) {}
+func (w *recordingResponseWriter) Hijack()             {}
+
+type staticAliasProvider struct {
+	snapshot *AliasSnapshot
+}
+
+func (p staticAliasProvider) Snapshot() *AliasSnapshot {
+	return p.snapshot
+}
+
+func newTestRegistry(aliases aliasSet) DNSRegistry {
+	return NewDNSRegistry(staticAliasProvider{snapshot: newAliasSnapshot(aliases, 8, 1)})
+}
+
+func registerTestContainer(registry DNSRegistry, containerID string, name string, ips ...string) {
+	registry.ReplaceContainer(containerID, ContainerRecords{
+		IPsByName:    map[string][]string{name: ips},
+		ReverseNames: []string{name},
+		Healthy:      true,
+	})
+}
+
+func query(t *testing.T, handler DNSHandler, name string, qtype uint16) *dns.Msg {
+	t.Helper()
+
+	r := &dns.Msg{}
+	r.SetQuestion(name, qtype)
+
+	w := &recordingResponseWriter{}
+	handler.ServeDNS(w, r)
+
+	if w.msg == nil {
+		t.Fatalf("no answer for %s %s", name, dns.TypeToString[qtype])
+	}
+
+	return w.msg
+}
+
+// answers returns the answer records in presentation format without their headers, e.g. "A 10.0.0.2".
+func answers(msg *dns.Msg) []string {
+	records := make([]string, 0, len(msg.Answer))
+	for _, rr := range msg.Answer {
+		records = append(records, dns.TypeToString[rr.Header().Rrtype]+" "+rr.String()[len(rr.Header().String()):])
+	}
+
+	return records
+}
+
+func TestDNSHandlerNameserver(t *testing.T) {
+	t.Parallel()
+
+	listen, err := ParseListenAddress("127.0.0.1:5353")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := newDNSHandler(newTestRegistry(newAliasSet()), Config{Zone: "docker.", Listen: listen})
+
+	msg := query(t, handler, "NS.docker.", dns.TypeA)
+	if got := answers(msg); len(got) != 1 || got[0] != "A 127.0.0.1" {
+		t.Errorf("expected the listen address, got %v", got)
+	}
+
+	if msg = query(t, handler, "docker.", dns.TypeNS); len(msg.Answer) != 1 || msg.Answer[0].(*dns.NS).Ns != "ns.docker." {
+		t.Errorf("expected the nameserver ns.docker., got %v", msg.Answer)
+	}
+}
+
+func TestDNSHandlerAddresses(t *testing.T) {
+	t.Parallel()
+
+	registry := newTestRegistry(newAliasSet())
+	registerTestContainer(registry, "a", "web.", "10.0.0.2", "fd00::2")
+	registerTestContainer(registry, "b", "db.", "10.0.0.3")
+
+	testCases := []struct {
+		name    string
+		qtype   uint16
+		answers []string
+		soa     bool
+	}{
+		{name: "web.", qtype: dns.TypeA, answers: []string{"A 10.0.0.2"}},
+		{name: "web.", qtype: dns.TypeAAAA, answers: []string{"AAAA fd00::2"}},
+		{name: "web.docker.", qtype: dns.TypeAAAA, answers: []string{"AAAA fd00::2"}},
+		{name: "db.", qtype: dns.TypeAAAA},
+		{name: "db.docker.", qtype: dns.TypeAAAA, soa: true},
+		{name: "db.", qtype: dns.TypeMX},
+	}
+
+	handler := newDNSHandler(registry, Config{Zone: "docker."})
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name+" "+dns.TypeToString[testCase.qtype], func(t *testing.T) {
+			t.Parallel()
+
+			msg := query(t, handler, testCase.name, testCase.qtype)
+			if msg.Rcode != dns.RcodeSuccess || !msg.Authoritative {
+				t.Fatalf("expected an authoritative answer, got %s", dns.RcodeToString[msg.Rcode])
+			}
+
+			if got := answers(msg); strings.Join(got, ",") != strings.Join(testCase.answers, ",") {
+				t.Errorf("expected %v, got %v", testCase.answers, got)
+			}
+
+			if soa := len(msg.Ns) == 1 && msg.Ns[0].Header().Rrtype == dns.TypeSOA; soa != testCase.soa {
+				t.Errorf("expected soa=%v, got %v", testCase.soa, msg.Ns)
+			}
+		})
+	}
+}
+
+func TestDNSHandlerZone(t *testing.T) {
+	t.Parallel()
+
+	registry := newTestRegistry(newAliasSet())
+	registerTestContainer(registry, "a", "web.", "10.0.0.2")
+
+	handler := newDNSHandler(registry, Config{Zone: "docker.", NegativeTTL: 10 * time.Second})
+
+	testCases := []struct {
+		name  string
+		qtype uint16
+		rcode int
+		soa   bool
+	}{
+		{name: "missing.docker.", qtype: dns.TypeA, rcode: dns.RcodeNameError, soa: true},
+		{name: "MISSING.docker.", qtype: dns.TypeAAAA, rcode: dns.RcodeNameError, soa: true},
+		{name: "docker.", qtype: dns.TypeA, soa: true},
+		{name: "missing.", qtype: dns.TypeA},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			msg := query(t, handler, testCase.name, testCase.qtype)
+			if msg.Rcode != testCase.rcode {
+				t.Errorf("expected %s, got %s", dns.RcodeToString[testCase.rcode], dns.RcodeToString[msg.Rcode])
+			}
+
+			if hasSOA := len(msg.Ns) > 0; hasSOA != testCase.soa {
+				t.Fatalf("expected soa=%v, got %v", testCase.soa, msg.Ns)
+			}
+
+			if soa, ok := firstRecord(msg.Ns).(*dns.SOA); testCase.soa && (!ok || soa.Minttl != 10 || soa.Hdr.Ttl != 10) {
+				t.Errorf("expected a SOA with the negative TTL, got %v", msg.Ns)
+			}
+		})
+	}
+}
+
+func firstRecord(records []dns.RR) dns.RR {
+	if len(records) == 0 {
+		return nil
+	}
+
+	return records[0]
+}
+
+func TestDNSHandlerPTR(t *testing.T) {
+	t.Parallel()
+
+	registry := newTestRegistry(newAliasSet())
+	registerTestContainer(registry, "a", "web.", "10.0.0.2", "fd00::2")
+
+	testCases := []struct {
+		zone    string
+		qname   string
+		answers []string
+	}{
+		{qname: "2.0.0.10.in-addr.arpa.", answers: []string{"PTR web."}},
+		{zone: "docker.", qname: "2.0.0.10.in-addr.arpa.", answers: []string{"PTR web.docker."}},
+		{zone: "docker.", qname: "2.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.d.f.ip6.arpa.", answers: []string{"PTR web.docker."}},
+		{zone: "docker.", qname: "3.0.0.10.in-addr.arpa."},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.zone+" "+testCase.qname, func(t *testing.T) {
+			t.Parallel()
+
+			msg := query(t, newDNSHandler(registry, Config{Zone: testCase.zone}), testCase.qname, dns.TypePTR)
+			if got := answers(msg); strings.Join(got, ",") != strings.Join(testCase.answers, ",") {
+				t.Errorf("expected %v, got %v", testCase.answers, got)
+			}
+		})
+	}
+}
+
+func TestDNSHandlerAliasCNAME(t *testing.T) {
+	t.Parallel()
+
+	aliases := newAliasSet()
+	for domain, alias := range map[string]Alias{
+		"www.test.":   {Target: "web."},
+		"short.test.": {Target: "web.", TTL: 10},
+		"addr.test.":  {Target: "web.", Type: AliasTypeAddress},
+		"gone.test.":  {Target: "gone."},
+	} {
+		if err := aliases.add(domain, alias); err != nil {
+			t.Fatalf("cannot add alias %s: %v", domain, err)
+		}
+	}
+
+	registry := newTestRegistry(aliases)
+	registerTestContainer(registry, "a", "web.", "10.0.0.2")
+
+	handler := newDNSHandler(registry, Config{AliasCNAME: true})
+
+	testCases := []struct {
+		qname   string
+		qtype   uint16
+		answers []string
+		ttl     uint32
+	}{
+		{qname: "www.test.", qtype: dns.TypeA, answers: []string{"CNAME web.", "A 10.0.0.2"}, ttl: recordTTL},
+		{qname: "short.test.", qtype: dns.TypeA, answers: []string{"CNAME web.", "A 10.0.0.2"}, ttl: 10},
+		{qname: "www.test.", qtype: dns.TypeAAAA, answers: []string{"CNAME web."}, ttl: recordTTL},
+		{qname: "www.test.", qtype: dns.TypeTXT, answers: []string{"CNAME web."}, ttl: recordTTL},
+		{qname: "addr.test.", qtype: dns.TypeA, answers: []string{"A 10.0.0.2"}, ttl: recordTTL},
+		{qname: "gone.test.", qtype: dns.TypeA, answers: []string{"CNAME gone."}, ttl: recordTTL},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.qname+" "+dns.TypeToString[testCase.qtype], func(t *testing.T) {
+			t.Parallel()
+
+			msg := query(t, handler, testCase.qname, testCase.qtype)
+			if got := answers(msg); strings.Join(got, ",") != strings.Join(testCase.answers, ",") {
+				t.Errorf("expected %v, got %v", testCase.answers, got)
+			}
+
+			for _, rr := range msg.Answer {
+				if rr.Header().Ttl != testCase.ttl {
+					t.Errorf("expected TTL %d, got %v", testCase.ttl, rr)
+				}
+			}
+		})
+	}
+}
+
+type fakeForwarder map[string]dns.RR
+
+func (f fakeForwarder) Forward(r *dns.Msg) (*dns.Msg, error) {
+	msg := &dns.Msg{}
+	msg.SetReply(r)
+
+	if rr, ok := f[r.Question[0].Name]; ok && rr.Header().Rrtype == r.Question[0].Qtype {
+		msg.Answer = append(msg.Answer, rr)
+	}
+
+	return msg, nil
+}
+
+func TestDNSHandlerAliasTargets(t *testing.T) {
+	t.Parallel()
+
+	aliases := newTestAliasSet(t, [][2]string{
+		{"static.test.", "10.0.0.1,fd00::1"},
+		{"ext.test.", "example.com."},
+		{"single.test.", "gone."},
+		{"inside.test.", "gone.docker."},
+	})
+	if err := aliases.add("cname.test.", Alias{Target: "example.com.", Type: AliasTypeCNAME}); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := newDNSHandler(newTestRegistry(aliases), Config{Zone: "docker."})
+	handler.forwarder = fakeForwarder{"example.com.": &dns.A{
+		Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: recordTTL},
+		A:   net.IPv4(192, 0, 2, 1),
+	}}
+
+	testCases := []struct {
+		qname   string
+		qtype   uint16
+		answers []string
+	}{
+		{qname: "static.test.", qtype: dns.TypeA, answers: []string{"A 10.0.0.1"}},
+		{qname: "static.test.", qtype: dns.TypeAAAA, answers: []string{"AAAA fd00::1"}},
+		{qname: "ext.test.", qtype: dns.TypeA, answers: []string{"A 192.0.2.1"}},
+		{qname: "ext.test.", qtype: dns.TypeAAAA, answers: []string{"CNAME example.com."}},
+		{qname: "cname.test.", qtype: dns.TypeA, answers: []string{"CNAME example.com.", "A 192.0.2.1"}},
+		{qname: "single.test.", qtype: dns.TypeA},
+		{qname: "inside.test.", qtype: dns.TypeA},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.qname+" "+dns.TypeToString[testCase.qtype], func(t *testing.T) {
+			t.Parallel()
+
+			msg := query(t, handler, testCase.qname, testCase.qtype)
+			if msg.Rcode != dns.RcodeSuccess {
+				t.Errorf("expected NOERROR, got %s", dns.RcodeToString[msg.Rcode])
+			}
+
+			if got := answers(msg); strings.Join(got, ",") != strings.Join(testCase.answers, ",") {
+				t.Errorf("expected %v, got %v", testCase.answers, got)
+			}
+
+			if ext := firstRecord(msg.Answer); ext != nil && ext.Header().Name != testCase.qname {
+				t.Errorf("expected the answer for %s, got %v", testCase.qname, ext)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package dnsserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const statusShutdownTimeout = 5 * time.Second
+const statusReadHeaderTimeout = 5 * time.Second
+
+type (
+	EventStreamMonitor interface {
+		EventStreamStatus() EventStreamStatus
+	}
+	ReconcileMonitor interface {
+		ReconcileStatus() ReconcileStatus
+	}
+	// HealthStatus is the response of the health endpoint.
+	HealthStatus struct {
+		Healthy     bool              `json:"healthy"`
+		EventStream EventStreamStatus `json:"eventStream"`
+	}
+)
+
+// NewStatusHandler returns the handler of the status endpoint:
+// GET /reload returns the result of the last reload, POST /reload reloads and returns the result.
+// GET /health reports whether docker-dns tracks the containers, answering 503 while the docker event stream is down.
+// GET /reconcile returns the summary of the reconciliations, if reconcileMonitor is not nil.
+func NewStatusHandler(
+	reloader Reloader,
+	eventStreamMonitor EventStreamMonitor,
+	reconcileMonitor ReconcileMonitor,
+) http.Handler {
+	mux := http.NewServeMux()
+
+	if reconcileMonitor != nil {
+		mux.HandleFunc("/reconcile", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				w.Header().Set("Allow", "GET")
+				http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+				return
+			}
+
+			writeJSON(w, http.StatusOK, reconcileMonitor.ReconcileStatus())
+		})
+	}
+
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		eventStream := eventStreamMonitor.EventStreamStatus()
+		health := HealthStatus{Healthy: eventStream.Connected, EventStream: eventStream}
+
+		status := http.StatusOK
+		if !health.Healthy {
+			status = http.StatusServiceUnavailable
+		}
+
+		writeJSON(w, status, health)
+	})
+	mux.HandleFunc("/reload", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, reloader.LastReload())
+		case http.MethodPost:
+			logrus.Info("Reloading due to status endpoint request")
+
+			result := reloader.Reload()
+
+			status := http.StatusOK
+			if len(result.Errors) > 0 {
+				status = http.StatusUnprocessableEntity
+			}
+
+			writeJSON(w, status, result)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	})
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Errorf("Could not write status response: %v", err)
+	}
+}
+
+// RunStatusServer serves the handler on the given address until ctx is done.
+func RunStatusServer(ctx context.Context, addr string, handler http.Handler) {
+	logrus.Infof("starting status endpoint on %s", addr)
+
+	srv := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: statusReadHeaderTimeout}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logrus.Errorf("Failed to serve status endpoint on %s: %v", addr, err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), statusShutdownTimeout)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			logrus.Errorf("Failed to gracefully shutdown status endpoint: %v", err)
+		}
+	}()
+}
@@ -1,22 +1,32 @@
 package dnsserver
 
 import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
 	"github.com/sirupsen/logrus"
 )
 
 type ContainerDNSSurvey struct {
-	dnsRegisterer          DNSRegisterer
+	dnsRegisterer          ContainerRegistrar
 	runningContainerGetter RunningContainersGetter
 	networkIPsGetter       NetworkIPsGetter
+	containerInspector     ContainerInspector
+	reconcileLock          *sync.Mutex
 }
 
-func NewContainerDNSSurvey(dnsRegisterer DNSRegisterer,
+func NewContainerDNSSurvey(dnsRegisterer ContainerRegistrar,
 	runningContainerGetter RunningContainersGetter,
-	networkIPsGetter NetworkIPsGetter) ContainerDNSSurvey {
+	networkIPsGetter NetworkIPsGetter,
+	containerInspector ContainerInspector) ContainerDNSSurvey {
 	return ContainerDNSSurvey{
 		networkIPsGetter:       networkIPsGetter,
+		containerInspector:     containerInspector,
 		dnsRegisterer:          dnsRegisterer,
 		runningContainerGetter: runningContainerGetter,
+		reconcileLock:          &sync.Mutex{},
 	}
 }
 
@@ -26,17 +36,129 @@ func (s ContainerDNSSurvey) Run() {
 		panic(err)
 	}
 
+	networkIDs, err := s.networkIPsGetter.GetNetworkIDs(containers)
+	if err != nil {
+		panic(err)
+	}
+
+	s.register(containers, networkIDs)
+}
+
+// Drift counts the differences between docker and the registry corrected by a reconciliation.
+type Drift struct {
+	// Added counts running containers which were missing in the registry.
+	Added int `json:"added"`
+	// Updated counts containers which were registered with other names, addresses or health.
+	Updated int `json:"updated"`
+	// Removed counts registered containers which were not running anymore.
+	Removed int `json:"removed"`
+}
+
+func (d Drift) Total() int {
+	return d.Added + d.Updated + d.Removed
+}
+
+// Resync registers all running containers like Run does and unregisters the containers which are not running anymore.
+func (s ContainerDNSSurvey) Resync() error {
+	_, err := s.Reconcile()
+
+	return err
+}
+
+// Reconcile diffs the running containers against the registry. It registers missing containers, re-registers
+// containers with outdated names, addresses or health and unregisters containers which are not running or withdrawn by the policy.
+// Only containers registered before the running containers were listed are unregistered, so a container
+// registered by an event in the meantime is kept. Concurrent reconciliations are run one after the other.
+func (s ContainerDNSSurvey) Reconcile() (Drift, error) {
+	s.reconcileLock.Lock()
+	defer s.reconcileLock.Unlock()
+
+	registeredIDs := s.dnsRegisterer.ContainerIDs()
+
+	containers, err := s.runningContainerGetter.GetRunningContainers()
+	if err != nil {
+		return Drift{}, fmt.Errorf("cannot reconcile containers: %w", err)
+	}
+
+	networkIDs, err := s.networkIPsGetter.GetNetworkIDs(containers)
+	if err != nil {
+		return Drift{}, fmt.Errorf("cannot reconcile containers: %w", err)
+	}
+
+	var (
+		drift      Drift
+		registered = map[string]bool{}
+		running    = map[string]bool{}
+	)
+
+	for _, containerID := range registeredIDs {
+		registered[containerID] = true
+	}
+
 	for _, container := range containers {
-		ips := s.networkIPsGetter.GetContainerNetworkIps(container)
+		ips := selectAddresses(s.networkIPsGetter.GetContainerNetworkIps(container, networkIDs))
 		if len(ips) == 0 {
-			logrus.Debugf("skipping container without ip '%s'", container.ID)
+			continue
+		}
 
+		details := s.containerInspector.InspectContainer(container, networkIDs)
+		if !s.dnsRegisterer.Serves(container, details) {
 			continue
 		}
 
-		for _, containerName := range container.Names {
-			ip := ips[len(ips)-1]
-			s.dnsRegisterer.Register(containerName, ip)
+		running[container.ID] = true
+
+		records := s.dnsRegisterer.Records(container, ips, details)
+
+		switch differences := s.dnsRegisterer.ContainerRecords(container.ID).differences(records); {
+		case !registered[container.ID]:
+			logrus.Infof("reconcile: adding missing container %s", containerName(container))
+
+			drift.Added++
+		case len(differences) > 0:
+			logrus.Infof("reconcile: updating container %s, registered %s", containerName(container),
+				strings.Join(differences, ", "))
+
+			drift.Updated++
+		}
+
+		s.dnsRegisterer.RegisterContainer(container, ips, details)
+	}
+
+	for _, containerID := range registeredIDs {
+		if !running[containerID] {
+			logrus.Infof("reconcile: removing container %s, it is not running or withdrawn", containerID)
+
+			s.dnsRegisterer.Unregister(containerID)
+
+			drift.Removed++
+		}
+	}
+
+	logrus.Infof("reconciled %d running containers, corrected %d differences", len(running), drift.Total())
+
+	return drift, nil
+}
+
+func containerName(container types.Container) string {
+	if len(container.Names) == 0 {
+		return container.ID
+	}
+
+	return normalizeContainerName(container.Names[0])
+}
+
+func (s ContainerDNSSurvey) register(containers []types.Container, networkIDs []string) {
+	for _, container := range containers {
+		ips := selectAddresses(s.networkIPsGetter.GetContainerNetworkIps(container, networkIDs))
+		if len(ips) == 0 {
+			logrus.Debugf("skipping container without ip '%s'", container.ID)
+
+			continue
 		}
+
+		details := s.containerInspector.InspectContainer(container, networkIDs)
+
+		s.dnsRegisterer.RegisterContainer(container, ips, details)
 	}
 }
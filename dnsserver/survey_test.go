@@ -0,0 +1,102 @@
+package dnsserver
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+type fakeDocker struct {
+	containers []types.Container
+	ips        map[string][]string
+	details    map[string]ContainerDetails
+}
+
+func (d *fakeDocker) GetRunningContainers() ([]types.Container, error) {
+	return d.containers, nil
+}
+
+func (d *fakeDocker) GetNetworkIDs([]types.Container) ([]string, error) {
+	return []string{"network"}, nil
+}
+
+func (d *fakeDocker) GetContainerNetworkIps(container types.Container, _ []string) []string {
+	return d.ips[container.ID]
+}
+
+func (d *fakeDocker) InspectContainer(container types.Container, _ []string) ContainerDetails {
+	return d.details[container.ID]
+}
+
+func TestContainerDNSSurveyReconcile(t *testing.T) {
+	t.Parallel()
+
+	unhealthy := &types.Health{Status: types.Unhealthy}
+
+	testCases := []struct {
+		name   string
+		change func(docker *fakeDocker)
+		drift  Drift
+	}{
+		{name: "unchanged", change: func(*fakeDocker) {}},
+		{
+			name: "added",
+			change: func(d *fakeDocker) {
+				d.containers = append(d.containers, types.Container{ID: "c", Names: []string{"/db"}})
+			},
+			drift: Drift{Added: 1},
+		},
+		{
+			name:   "removed",
+			change: func(d *fakeDocker) { d.containers = d.containers[:1] },
+			drift:  Drift{Removed: 1},
+		},
+		{
+			name:   "address changed",
+			change: func(d *fakeDocker) { d.ips["a"] = []string{"10.0.0.9"} },
+			drift:  Drift{Updated: 1},
+		},
+		{
+			name:   "renamed",
+			change: func(d *fakeDocker) { d.containers[0].Names = []string{"/web2"} },
+			drift:  Drift{Updated: 1},
+		},
+		{
+			name:   "health changed",
+			change: func(d *fakeDocker) { d.details["b"] = ContainerDetails{Health: unhealthy} },
+			drift:  Drift{Updated: 1},
+		},
+	}
+
+	for _, testCase := range testCases {
+		testCase := testCase
+
+		t.Run(testCase.name, func(t *testing.T) {
+			t.Parallel()
+
+			docker := &fakeDocker{
+				containers: []types.Container{{ID: "a", Names: []string{"/web"}}, {ID: "b", Names: []string{"/api"}}},
+				ips:        map[string][]string{"a": {"10.0.0.2"}, "b": {"10.0.0.3"}, "c": {"10.0.0.4"}},
+				details:    map[string]ContainerDetails{},
+			}
+			registry := NewDNSRegistry(nil)
+			survey := NewContainerDNSSurvey(NewContainerRegistry(registry, ContainerPolicy{}), docker, docker, docker)
+
+			survey.Run()
+			testCase.change(docker)
+
+			drift, err := survey.Reconcile()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if drift != testCase.drift {
+				t.Errorf("expected drift %+v, got %+v", testCase.drift, drift)
+			}
+
+			if drift, _ = survey.Reconcile(); drift.Total() != 0 {
+				t.Errorf("expected no drift after reconciling, got %+v", drift)
+			}
+		})
+	}
+}
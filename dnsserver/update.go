@@ -4,6 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/events"
@@ -12,28 +15,58 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-var ErrGettingContainerName = errors.New("error getting container name")
 var ErrGettingContainerIP = errors.New("error getting container IP")
 var ErrGettingContainerByID = errors.New("error while getting container by ID")
 var ErrNoContainerFoundForID = errors.New("no container found")
+var ErrEventStreamClosed = errors.New("docker event stream closed")
 
-type DNSUpdater struct {
-	dockerClientAdapter DockerClientAdapter
-	dockerClient        *client.Client
-	ctx                 context.Context
-	dnsRegistry         DNSRegistrar
-}
+// healthStatusAction is the prefix of the actions of health events, like "health_status: unhealthy".
+const healthStatusAction = "health_status"
+
+const (
+	eventStreamMinBackoff = time.Second
+	eventStreamMaxBackoff = time.Minute
+)
 
+type (
+	DNSUpdater struct {
+		dockerClientAdapter DockerClientAdapter
+		dockerClient        *client.Client
+		ctx                 context.Context
+		dnsRegistry         ContainerRegistrar
+		resyncer            ContainerResyncer
+		eventStream         *eventStreamState
+	}
+	// EventStreamStatus tells whether docker-dns currently receives the container events of docker.
+	EventStreamStatus struct {
+		Connected bool `json:"connected"`
+		// Since is the time of the last connect or disconnect.
+		Since      time.Time `json:"since"`
+		LastError  string    `json:"lastError,omitempty"`
+		Reconnects int       `json:"reconnects"`
+	}
+	eventStreamState struct {
+		lock   sync.Mutex
+		status EventStreamStatus
+	}
+)
+
+// NewDNSUpdater starts updating the registry by docker container events.
+// If the event stream fails, it is reconnected with exponential backoff and the containers are resynced
+// with the resyncer to catch up on the events missed meanwhile.
 func NewDNSUpdater(ctx context.Context,
 	dockerClient *client.Client,
 	dockerClientAdapter DockerClientAdapter,
-	dnsRegistry DNSRegistrar,
+	dnsRegistry ContainerRegistrar,
+	resyncer ContainerResyncer,
 ) DNSUpdater {
 	u := DNSUpdater{
 		dockerClientAdapter: dockerClientAdapter,
 		dockerClient:        dockerClient,
 		ctx:                 ctx,
 		dnsRegistry:         dnsRegistry,
+		resyncer:            resyncer,
+		eventStream:         &eventStreamState{},
 	}
 
 	u.start()
@@ -47,92 +80,234 @@ func (u DNSUpdater) start() {
 	}()
 }
 
+// EventStreamStatus returns the current state of the docker event stream.
+func (u DNSUpdater) EventStreamStatus() EventStreamStatus {
+	u.eventStream.lock.Lock()
+	defer u.eventStream.lock.Unlock()
+
+	return u.eventStream.status
+}
+
 func (u DNSUpdater) startEventListener() {
-	evtCh, errCh := u.registerContainerEvents()
+	backoff := eventStreamMinBackoff
 
-	for {
-		select {
-		case <-errCh:
-			logrus.Errorf("error in docker event loop, stopping Docker DNS Survey")
+	for reconnect := false; ; reconnect = true {
+		err := u.listenForEvents(reconnect)
+		if u.ctx.Err() != nil {
+			logrus.Info("Stopping Docker DNS Survey")
 
 			return
-		case e := <-evtCh:
-			switch e.Action {
-			case "kill", "die", "stop":
-				u.removeContainerFromDNS(e)
-			case "start":
-				u.addContainerToDNS(e)
-			}
+		}
+
+		if u.eventStream.disconnected(err) {
+			backoff = eventStreamMinBackoff
+		}
+
+		logrus.Errorf("error in docker event loop: %v, reconnecting in %v", err, backoff)
+
+		select {
+		case <-time.After(backoff):
 		case <-u.ctx.Done():
 			logrus.Info("Stopping Docker DNS Survey")
 
 			return
 		}
+
+		if backoff *= 2; backoff > eventStreamMaxBackoff {
+			backoff = eventStreamMaxBackoff
+		}
+	}
+}
+
+// listenForEvents updates the registry by container events until the event stream fails or ctx is done.
+// After reconnecting, the containers are resynced before handling events.
+func (u DNSUpdater) listenForEvents(reconnect bool) error {
+	ctx, cancel := context.WithCancel(u.ctx)
+	defer cancel()
+
+	evtCh, errCh := u.registerContainerEvents(ctx)
+
+	// a failed connect is reported right away
+	select {
+	case err, ok := <-errCh:
+		return eventStreamError(err, ok)
+	default:
+	}
+
+	if reconnect {
+		if err := u.resyncer.Resync(); err != nil {
+			return err
+		}
+	}
+
+	u.eventStream.connected(reconnect)
+
+	for {
+		select {
+		case err, ok := <-errCh:
+			return eventStreamError(err, ok)
+		case e := <-evtCh:
+			u.handleEvent(e)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (u DNSUpdater) handleEvent(e events.Message) {
+	switch e.Type {
+	case events.ContainerEventType:
+		switch {
+		case e.Action == "kill", e.Action == "die", e.Action == "stop":
+			u.removeContainerFromDNS(e)
+		case e.Action == "start", e.Action == "rename", e.Action == "pause", e.Action == "unpause",
+			strings.HasPrefix(e.Action, healthStatusAction):
+			// the container is registered again, which replaces its records at once, e.g. old by new names,
+			// or withdraws them according to the ContainerPolicy
+			u.addContainerToDNS(e)
+		}
+	case events.NetworkEventType:
+		switch e.Action {
+		case "connect", "disconnect":
+			u.updateContainerNetworks(e)
+		}
 	}
 }
 
-func (u DNSUpdater) registerContainerEvents() (<-chan events.Message, <-chan error) {
+func eventStreamError(err error, ok bool) error {
+	if !ok || err == nil {
+		return ErrEventStreamClosed
+	}
+
+	return err
+}
+
+func (u DNSUpdater) registerContainerEvents(ctx context.Context) (<-chan events.Message, <-chan error) {
 	eventFilter := filters.NewArgs()
-	eventFilter.Add("type", "container")
+	eventFilter.Add("type", events.ContainerEventType)
+	eventFilter.Add("type", events.NetworkEventType)
 
 	options := types.EventsOptions{
 		Filters: eventFilter,
 	}
-	evtCh, errCh := u.dockerClient.Events(u.ctx, options)
+	evtCh, errCh := u.dockerClient.Events(ctx, options)
 
 	return evtCh, errCh
 }
 
+func (s *eventStreamState) connected(reconnect bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if reconnect {
+		s.status.Reconnects++
+
+		logrus.Infof("reconnected to docker event stream")
+	}
+
+	s.status.Connected = true
+	s.status.Since = time.Now()
+}
+
+// disconnected records the error the event stream failed with and reports whether it was connected before.
+func (s *eventStreamState) disconnected(err error) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	wasConnected := s.status.Connected
+
+	s.status.LastError = err.Error()
+
+	if wasConnected {
+		s.status.Connected = false
+		s.status.Since = time.Now()
+	}
+
+	return wasConnected
+}
+
 func (u DNSUpdater) addContainerToDNS(e events.Message) {
-	ip, err := u.getContainerIP(e.Actor.ID)
+	container, err := u.getContainerByID(e.Actor.ID)
 	if err != nil {
-		logrus.Errorf("could not determine container ip: %v", err)
+		logrus.Errorf("could not determine container: %v", err)
 
 		return
 	}
 
-	containerName, err := u.getContainerName(e.Actor.ID)
+	ips, details, err := u.getContainerAddresses(container)
 	if err != nil {
-		logrus.Errorf("could not determine container name: %v", err)
+		logrus.Errorf("could not determine container ip: %v", err)
 
 		return
 	}
 
-	logrus.Infof("adding container %s due to (%s) event", containerName, e.Action)
+	logrus.Infof("registering container %s due to (%s) event", container.Names[0], e.Action)
 
-	u.dnsRegistry.Register(containerName, ip)
+	u.dnsRegistry.RegisterContainer(container, ips, details)
 }
 
-func (u DNSUpdater) removeContainerFromDNS(e events.Message) {
-	containerName, err := u.getContainerName(e.Actor.ID)
+// updateContainerNetworks re-evaluates the addresses of a running container connected to or disconnected from
+// a network. Containers without an address in a shared network anymore are removed.
+func (u DNSUpdater) updateContainerNetworks(e events.Message) {
+	containerID := e.Actor.Attributes["container"]
+
+	container, err := u.getContainerByID(containerID)
 	if err != nil {
-		logrus.Errorf("could not determine container name: %v", err)
+		logrus.Errorf("could not determine container: %v", err)
+
 		return
 	}
 
-	logrus.Infof("removing container %s due to (%s) event", containerName, e.Action)
+	// containers are disconnected from their networks when they stop, which the container events handle
+	if container.State != "running" {
+		return
+	}
 
-	u.dnsRegistry.Unregister(containerName)
-}
+	// the networks docker-dns shares with other containers changed, which affects all of them
+	if u.dockerClientAdapter.IsOwnContainer(container) {
+		logrus.Infof("resyncing all containers due to network %s (%s) event of docker-dns", e.Actor.Attributes["name"], e.Action)
 
-func (u DNSUpdater) getContainerName(containerID string) (string, error) {
-	container, err := u.getContainerByID(containerID)
+		if err := u.resyncer.Resync(); err != nil {
+			logrus.Errorf("could not resync containers: %v", err)
+		}
+
+		return
+	}
+
+	ips, details, err := u.getContainerAddresses(container)
 	if err != nil {
-		return "", fmt.Errorf("%w: %w", ErrGettingContainerName, err)
+		logrus.Infof("removing container %s due to network (%s) event: %v", container.Names[0], e.Action, err)
+
+		u.dnsRegistry.Unregister(container.ID)
+
+		return
 	}
 
-	return container.Names[0], nil
+	logrus.Infof("updating container %s due to network %s (%s) event", container.Names[0], e.Actor.Attributes["name"], e.Action)
+
+	u.dnsRegistry.RegisterContainer(container, ips, details)
 }
 
-func (u DNSUpdater) getContainerIP(containerID string) (string, error) {
-	container, err := u.getContainerByID(containerID)
+func (u DNSUpdater) removeContainerFromDNS(e events.Message) {
+	logrus.Infof("removing container %s due to (%s) event", e.Actor.Attributes["name"], e.Action)
+
+	u.dnsRegistry.Unregister(e.Actor.ID)
+}
+
+// getContainerAddresses returns the addresses of the container in the networks it shares with docker-dns
+// along with its details.
+func (u DNSUpdater) getContainerAddresses(container types.Container) ([]string, ContainerDetails, error) {
+	networkIDs, err := u.dockerClientAdapter.getNetworkIDs()
 	if err != nil {
-		return "", fmt.Errorf("%w: %w", ErrGettingContainerIP, err)
+		return nil, ContainerDetails{}, fmt.Errorf("%w: cannot determine shared networks: %w", ErrGettingContainerIP, err)
 	}
 
-	ips := u.dockerClientAdapter.GetContainerNetworkIps(container)
+	ips := selectAddresses(u.dockerClientAdapter.GetContainerNetworkIps(container, networkIDs))
+	if len(ips) == 0 {
+		return nil, ContainerDetails{}, fmt.Errorf("%w: no ip in a shared network for id '%s'", ErrGettingContainerIP, container.ID)
+	}
 
-	return ips[len(ips)-1], nil
+	return ips, u.dockerClientAdapter.InspectContainer(container, networkIDs), nil
 }
 
 func (u DNSUpdater) getContainerByID(containerID string) (types.Container, error) {
@@ -0,0 +1,247 @@
+package dnsserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+)
+
+const testNetworkID = "net"
+
+// fakeDockerAPI serves the parts of the docker API docker-dns uses from a list of containers.
+// docker-dns itself is the container with the address 127.0.0.1 in the test network.
+type fakeDockerAPI struct {
+	lock       sync.Mutex
+	containers map[string]types.Container
+	health     map[string]*types.Health
+}
+
+func newFakeDockerAPI() *fakeDockerAPI {
+	api := &fakeDockerAPI{containers: map[string]types.Container{}, health: map[string]*types.Health{}}
+	api.setContainer(newTestContainer("dns", "/docker-dns", "127.0.0.1"), nil)
+
+	return api
+}
+
+// newTestContainer returns a running container with the given address in the test network, or in no network if empty.
+func newTestContainer(containerID string, name string, ip string) types.Container {
+	networks := map[string]*network.EndpointSettings{}
+	if ip != "" {
+		networks[testNetworkID] = &network.EndpointSettings{NetworkID: testNetworkID, IPAddress: ip}
+	}
+
+	return types.Container{
+		ID:              containerID,
+		Names:           []string{name},
+		State:           "running",
+		NetworkSettings: &types.SummaryNetworkSettings{Networks: networks},
+	}
+}
+
+func (a *fakeDockerAPI) setContainer(container types.Container, health *types.Health) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.containers[container.ID] = container
+	a.health[container.ID] = health
+}
+
+func (a *fakeDockerAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	path := r.URL.Path[strings.Index(r.URL.Path, "/containers/"):]
+
+	switch {
+	case path == "/containers/json":
+		a.list(w, r)
+	case strings.HasSuffix(path, "/json"):
+		a.inspect(w, strings.TrimSuffix(strings.TrimPrefix(path, "/containers/"), "/json"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (a *fakeDockerAPI) list(w http.ResponseWriter, r *http.Request) {
+	args, err := filters.FromJSON(r.URL.Query().Get("filters"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	containers := []types.Container{}
+
+	for _, container := range a.containers {
+		if args.Contains("id") && !args.ExactMatch("id", container.ID) {
+			continue
+		}
+
+		if r.URL.Query().Get("all") != "1" && container.State != "running" {
+			continue
+		}
+
+		containers = append(containers, container)
+	}
+
+	writeJSON(w, http.StatusOK, containers)
+}
+
+func (a *fakeDockerAPI) inspect(w http.ResponseWriter, containerID string) {
+	container, ok := a.containers[containerID]
+	if !ok {
+		http.Error(w, `{"message": "no such container"}`, http.StatusNotFound)
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    container.ID,
+			State: &types.ContainerState{Status: container.State, Health: a.health[containerID]},
+		},
+		NetworkSettings: &types.NetworkSettings{Networks: container.NetworkSettings.Networks},
+	})
+}
+
+type countingResyncer struct {
+	lock    sync.Mutex
+	resyncs int
+}
+
+func (r *countingResyncer) Resync() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.resyncs++
+
+	return nil
+}
+
+// newTestDNSUpdater returns a DNSUpdater for the fake docker API without listening for events.
+func newTestDNSUpdater(t *testing.T, api *fakeDockerAPI, registry ContainerRegistrar, resyncer ContainerResyncer) DNSUpdater {
+	t.Helper()
+
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+
+	dockerClient, err := client.NewClientWithOpts(
+		client.WithHost("tcp://"+strings.TrimPrefix(server.URL, "http://")),
+		client.WithVersion("1.43"),
+	)
+	if err != nil {
+		t.Fatalf("cannot create docker client: %v", err)
+	}
+
+	t.Cleanup(func() { _ = dockerClient.Close() })
+
+	return DNSUpdater{
+		dockerClientAdapter: NewDockerClientAdapter(dockerClient),
+		dockerClient:        dockerClient,
+		ctx:                 context.Background(),
+		dnsRegistry:         registry,
+		resyncer:            resyncer,
+		eventStream:         &eventStreamState{},
+	}
+}
+
+func networkEvent(action string, containerID string) events.Message {
+	return events.Message{
+		Type:   events.NetworkEventType,
+		Action: action,
+		Actor:  events.Actor{ID: testNetworkID, Attributes: map[string]string{"container": containerID, "name": testNetworkID}},
+	}
+}
+
+func lookupTestName(registry DNSRegistry, name string) []string {
+	ips, _ := registry.LookupIP(newAliasSnapshot(newAliasSet(), 1, 0), name)
+
+	return ips
+}
+
+func TestDNSUpdaterNetworkEvents(t *testing.T) {
+	t.Parallel()
+
+	api := newFakeDockerAPI()
+	registry := NewDNSRegistry(nil)
+	resyncer := &countingResyncer{}
+	updater := newTestDNSUpdater(t, api, NewContainerRegistry(registry, ContainerPolicy{}), resyncer)
+
+	api.setContainer(newTestContainer("a", "/web", "10.0.0.2"), nil)
+	updater.handleEvent(networkEvent("connect", "a"))
+
+	if ips := lookupTestName(registry, "web."); strings.Join(ips, ",") != "10.0.0.2" {
+		t.Errorf("expected web. to be registered after connecting, got %v", ips)
+	}
+
+	api.setContainer(newTestContainer("a", "/web", ""), nil)
+	updater.handleEvent(networkEvent("disconnect", "a"))
+
+	if ips := lookupTestName(registry, "web."); ips != nil {
+		t.Errorf("expected web. to be removed after disconnecting, got %v", ips)
+	}
+
+	updater.handleEvent(networkEvent("connect", "dns"))
+
+	if resyncer.resyncs != 1 {
+		t.Errorf("expected a resync after docker-dns was connected, got %d", resyncer.resyncs)
+	}
+}
+
+func TestDNSUpdaterContainerEvents(t *testing.T) {
+	t.Parallel()
+
+	api := newFakeDockerAPI()
+	registry := NewDNSRegistry(nil)
+	policy := ContainerPolicy{WithdrawPaused: true, WithdrawUnhealthy: true}
+	updater := newTestDNSUpdater(t, api, NewContainerRegistry(registry, policy), &countingResyncer{})
+
+	paused := newTestContainer("a", "/app", "10.0.0.2")
+	paused.State = "paused"
+
+	testCases := []struct {
+		action    string
+		container types.Container
+		health    *types.Health
+		names     map[string]string
+	}{
+		{action: "start", container: newTestContainer("a", "/web", "10.0.0.2"), names: map[string]string{"web.": "10.0.0.2"}},
+		{action: "rename", container: newTestContainer("a", "/app", "10.0.0.2"), names: map[string]string{"web.": "", "app.": "10.0.0.2"}},
+		{action: "pause", container: paused, names: map[string]string{"app.": ""}},
+		{action: "unpause", container: newTestContainer("a", "/app", "10.0.0.2"), names: map[string]string{"app.": "10.0.0.2"}},
+		{
+			action:    "health_status: unhealthy",
+			container: newTestContainer("a", "/app", "10.0.0.2"),
+			health:    &types.Health{Status: types.Unhealthy},
+			names:     map[string]string{"app.": ""},
+		},
+		{
+			action:    "health_status: healthy",
+			container: newTestContainer("a", "/app", "10.0.0.2"),
+			health:    &types.Health{Status: types.Healthy},
+			names:     map[string]string{"app.": "10.0.0.2"},
+		},
+		{action: "die", container: newTestContainer("a", "/app", "10.0.0.2"), names: map[string]string{"app.": ""}},
+	}
+
+	// the events are handled one after the other, each test case depends on the state left by the previous one
+	for _, testCase := range testCases {
+		api.setContainer(testCase.container, testCase.health)
+		updater.handleEvent(events.Message{Type: events.ContainerEventType, Action: testCase.action, Actor: events.Actor{ID: "a"}})
+
+		for name, ips := range testCase.names {
+			if got := lookupTestName(registry, name); strings.Join(got, ",") != ips {
+				t.Errorf("%s: expected %s to resolve to %q, got %v", testCase.action, name, ips, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package dnsserver
+
+import (
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const defaultNegativeTTL = 30 * time.Second
+
+const (
+	soaRefresh = 3600
+	soaRetry   = 600
+	soaExpire  = 86400
+)
+
+// zone is the DNS zone docker-dns is authoritative for.
+type zone struct {
+	origin      string
+	negativeTTL uint32
+	serial      uint32
+	// nameserverIPs are the addresses the nameserver of the zone resolves to.
+	nameserverIPs []string
+}
+
+// newZone returns the zone for the given origin, or nil if no origin is configured.
+// The nameserver of the zone resolves to the addresses docker-dns listens on.
+func newZone(origin string, negativeTTL time.Duration, listenAddresses []ListenAddress) *zone {
+	if origin == "" {
+		return nil
+	}
+
+	if negativeTTL <= 0 {
+		negativeTTL = defaultNegativeTTL
+	}
+
+	return &zone{
+		origin:        dns.CanonicalName(origin),
+		negativeTTL:   uint32(negativeTTL.Seconds()),
+		serial:        uint32(time.Now().Unix()),
+		nameserverIPs: hostAddresses(listenAddresses),
+	}
+}
+
+// contains reports whether the name is the zone apex or below it.
+func (z *zone) contains(name string) bool {
+	return z != nil && dns.IsSubDomain(z.origin, name)
+}
+
+func (z *zone) isApex(name string) bool {
+	return z != nil && dns.CanonicalName(name) == z.origin
+}
+
+// relativeName strips the zone origin from the name, e.g. "pong.docker." becomes "pong.".
+func (z *zone) relativeName(name string) (string, bool) {
+	if !z.contains(name) || z.isApex(name) {
+		return "", false
+	}
+
+	labels := dns.SplitDomainName(name)
+	originLabels := dns.CountLabel(z.origin)
+
+	return strings.Join(labels[:len(labels)-originLabels], ".") + ".", true
+}
+
+// absoluteName returns the name of a container inside the zone, e.g. "pong." becomes "pong.docker.".
+// Without a zone, the name is returned as it is.
+func (z *zone) absoluteName(name string) string {
+	if z == nil || z.contains(name) {
+		return name
+	}
+
+	return strings.TrimSuffix(name, ".") + "." + z.origin
+}
+
+func (z *zone) nameserver() string {
+	return "ns." + z.origin
+}
+
+// isNameserver reports whether the name is the nameserver of the zone, which docker-dns answers with its addresses.
+func (z *zone) isNameserver(name string) bool {
+	return z != nil && dns.CanonicalName(name) == z.nameserver()
+}
+
+func (z *zone) soa() *dns.SOA {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: z.origin, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: z.negativeTTL},
+		Ns:      z.nameserver(),
+		Mbox:    "hostmaster." + z.origin,
+		Serial:  z.serial,
+		Refresh: soaRefresh,
+		Retry:   soaRetry,
+		Expire:  soaExpire,
+		Minttl:  z.negativeTTL,
+	}
+}
+
+func (z *zone) ns() *dns.NS {
+	return &dns.NS{
+		Hdr: dns.RR_Header{Name: z.origin, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: recordTTL},
+		Ns:  z.nameserver(),
+	}
+}
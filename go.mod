@@ -3,11 +3,14 @@ module github.com/Oppodelldog/docker-dns
 go 1.21
 
 require (
+	github.com/BurntSushi/toml v1.3.2
 	github.com/Oppodelldog/dockertest v0.0.14
 	github.com/Oppodelldog/filediscovery v0.3.0
 	github.com/docker/docker v24.0.7+incompatible
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/miekg/dns v1.1.56
 	github.com/sirupsen/logrus v1.9.3
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -67,7 +67,7 @@ func main() {
 
 	dnsContainer, err := baseBuilder.NewContainerBuilder().
 		Name("dns-server").
-		Cmd("go run dnsserver/cmd/main.go").
+		Cmd("go run ./dnsserver/cmd").
 		IPAddress(dnsServerIP, net).
 		Mount(dockerSocketPath, dockerSocketPath).
 		Env("DOCKER_DNS_ALIAS_FILE", "dnsserver/data/alias").